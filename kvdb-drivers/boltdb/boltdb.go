@@ -11,6 +11,7 @@ import (
 )
 
 const Features = kvdb.FeatureStore |
+	kvdb.FeatureCounter |
 	kvdb.FeatureNext |
 	kvdb.FeaturePrev |
 	kvdb.FeatureEmbedded
@@ -20,18 +21,28 @@ type Driver struct {
 	Database string
 	FileMode os.FileMode
 	Bucket   []byte
-	DB       *bolt.DB
+	//CounterBucket bucket which counters are stored in.
+	//Bucket name prefixed with kvdb.SuggestedCounterPrefix will be used if nil.
+	CounterBucket []byte
+	DB            *bolt.DB
 }
 
 //Start start database
 func (d *Driver) Start() error {
 	var err error
+	if d.CounterBucket == nil {
+		d.CounterBucket = getCounterBucket(d.Bucket)
+	}
 	d.DB, err = bolt.Open(d.Database, d.FileMode, nil)
 	if err != nil {
 		return err
 	}
 	return d.DB.Update(func(tx *bolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists(d.Bucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(d.CounterBucket)
 		return err
 	})
 
@@ -196,7 +207,9 @@ func (d *Driver) Features() kvdb.Feature {
 
 type Config struct {
 	Database string
-	Bucket   string
+	//Bucket bucket which values are stored in.
+	//Counters are stored in a sibling bucket named with kvdb.SuggestedCounterPrefix followed by Bucket.
+	Bucket string
 }
 
 func (c *Config) ApplyTo(d *Driver) error {
@@ -208,6 +221,7 @@ func (c *Config) ApplyTo(d *Driver) error {
 	}
 	d.Database = c.Database
 	d.Bucket = []byte(c.Bucket)
+	d.CounterBucket = getCounterBucket(d.Bucket)
 	return nil
 }
 func (c *Config) CreateDriver() (kvdb.Driver, error) {
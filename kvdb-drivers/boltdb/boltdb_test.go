@@ -6,8 +6,10 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"testing"
 
+	bolt "github.com/etcd-io/bbolt"
 	"github.com/herb-go/herbdata"
 
 	"github.com/herb-go/herbdata/kvdb"
@@ -161,3 +163,152 @@ func TestPrevOrder(t *testing.T) {
 		t.Fatal(result)
 	}
 }
+
+func TestCounter(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	d, err := (&Config{Bucket: "test", Database: path.Join(db, "test.bolt")}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	if string(d.(*Driver).CounterBucket) != string(kvdb.SuggestedCounterPrefix)+"test" {
+		t.Fatal(d.(*Driver).CounterBucket)
+	}
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err = d.Stop()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	for _, v := range "ace" {
+		err = d.Set([]byte{byte(v)}, []byte{byte(v)})
+		if err != nil {
+			panic(err)
+		}
+	}
+	for _, v := range "bdf" {
+		err = d.SetCounter([]byte{byte(v)}, 1)
+		if err != nil {
+			panic(err)
+		}
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				_, err := d.IncreaseCounter([]byte("b"), 1)
+				if err != nil {
+					panic(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	c, err := d.GetCounter([]byte("b"))
+	if c != 201 || err != nil {
+		t.Fatal(c, err)
+	}
+	_, err = d.Get([]byte("b"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	c, err = d.GetCounter([]byte("a"))
+	if c != 0 || err != nil {
+		t.Fatal(c, err)
+	}
+	var result = ""
+	var iter []byte
+	var data []*herbdata.KeyValue
+	for {
+		data, iter, err = d.Next(iter, 1)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range data {
+			result = result + string(v.Key)
+		}
+		if len(iter) == 0 {
+			break
+		}
+	}
+	for {
+		data, iter, err = d.Prev(iter, 1)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range data {
+			result = result + string(v.Key)
+		}
+		if len(iter) == 0 {
+			break
+		}
+	}
+	if result != "aceeca" {
+		t.Fatal(result)
+	}
+	err = d.(*Driver).DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(d.(*Driver).CounterBucket).Put([]byte("invalid"), []byte("value"))
+	})
+	if err != nil {
+		panic(err)
+	}
+	_, err = d.IncreaseCounter([]byte("invalid"), 1)
+	if err != ErrInvalidCounterValue {
+		t.Fatal(err)
+	}
+}
+
+func TestLiteralDriver(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	d := &Driver{Database: path.Join(db, "test.bolt"), FileMode: 0600, Bucket: []byte("test")}
+	err = d.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = d.Stop()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	if string(d.CounterBucket) != string(kvdb.SuggestedCounterPrefix)+"test" {
+		t.Fatal(d.CounterBucket)
+	}
+	err = d.Set([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := d.IncreaseCounter([]byte("key"), 2)
+	if c != 2 || err != nil {
+		t.Fatal(c, err)
+	}
+	data, err := d.Get([]byte("key"))
+	if string(data) != "value" || err != nil {
+		t.Fatal(string(data), err)
+	}
+}
@@ -0,0 +1,86 @@
+package boltdb
+
+import (
+	"encoding/binary"
+	"errors"
+
+	bolt "github.com/etcd-io/bbolt"
+	"github.com/herb-go/herbdata/kvdb"
+)
+
+//ErrInvalidCounterValue error raised if stored counter value is not a 8 bytes int64.
+var ErrInvalidCounterValue = errors.New("boltdb: invalid counter value")
+
+//getCounterBucket return name of bucket which counters are stored in,
+//derived from given data bucket name.
+func getCounterBucket(bucket []byte) []byte {
+	return append([]byte{kvdb.SuggestedCounterPrefix}, bucket...)
+}
+
+func encodeCounter(value int64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(value))
+	return data
+}
+
+func decodeCounter(data []byte) (int64, error) {
+	if data == nil {
+		return 0, nil
+	}
+	if len(data) != 8 {
+		return 0, ErrInvalidCounterValue
+	}
+	return int64(binary.BigEndian.Uint64(data)), nil
+}
+
+//SetCounter set counter value with given key
+func (d *Driver) SetCounter(key []byte, value int64) error {
+	return d.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(d.CounterBucket)
+		return b.Put(key, encodeCounter(value))
+	})
+}
+
+//IncreaseCounter increace counter value with given key and increasement.
+//Value not existed coutn as 0.
+//Return final value and any error if raised.
+func (d *Driver) IncreaseCounter(key []byte, incr int64) (int64, error) {
+	var result int64
+	err := d.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(d.CounterBucket)
+		v, err := decodeCounter(b.Get(key))
+		if err != nil {
+			return err
+		}
+		result = v + incr
+		return b.Put(key, encodeCounter(result))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+//GetCounter get counter value with given key
+//Value not existed coutn as 0.
+func (d *Driver) GetCounter(key []byte) (int64, error) {
+	var result int64
+	err := d.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(d.CounterBucket)
+		var err error
+		result, err = decodeCounter(b.Get(key))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+//DeleteCounter delete counter value with given key
+func (d *Driver) DeleteCounter(key []byte) error {
+	return d.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(d.CounterBucket)
+		return b.Delete(key)
+	})
+}
@@ -0,0 +1,406 @@
+package goredisdb
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/herb-go/herbdata"
+	"github.com/herb-go/herbdata-drivers/kvdb-drivers/internal/redisscan"
+	"github.com/herb-go/herbdata/kvdb"
+	"github.com/redis/go-redis/v9"
+)
+
+//Driver redis key-value database driver built on go-redis client.
+//Keys are stored in same layout as redisdb driver,and iters of Next are compatible.
+//Keys and values are stored as they are,so data can only be shared with redisdb drivers
+//without Compression,MaxKeyLength,StoreOriginalKey or Hash mode.
+//Values compressed by redisdb are returned compressed,and values stored with hashed keys can not be found.
+type Driver struct {
+	kvdb.Nop
+	//Client go-redis client.
+	//Hooks like tracing can be added to client directly.
+	Client redis.UniversalClient
+	Prefix string
+	ctx    context.Context
+}
+
+//FullFeatures features supported by driver
+var FullFeatures = kvdb.FeatureStore |
+	kvdb.FeatureInsert |
+	kvdb.FeatureUpdate |
+	kvdb.FeatureTTLStore |
+	kvdb.FeatureTTLInsert |
+	kvdb.FeatureTTLUpdate |
+	kvdb.FeatureTTLCounter |
+	kvdb.FeatureCounter |
+	kvdb.FeatureNext
+
+//ErrInvalidIter error raised if iter passed to Next is not created by redis drivers
+var ErrInvalidIter = redisscan.ErrInvalidIter
+
+//ErrClusterWithSentinel error raised if both cluster and sentinel mode are enabled
+var ErrClusterWithSentinel = errors.New("goredisdb: cluster and sentinel mode can not be used together")
+
+//Features return supported features
+func (d *Driver) Features() kvdb.Feature {
+	return FullFeatures
+}
+
+//WithContext return copy of driver which runs commands with given context.
+//Commands will be canceled when context is done.
+func (d *Driver) WithContext(ctx context.Context) *Driver {
+	driver := *d
+	driver.ctx = ctx
+	return &driver
+}
+
+func (d *Driver) context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+//Close close client
+func (d *Driver) Close() error {
+	return d.Client.Close()
+}
+
+func (d *Driver) getKey(key []byte) string {
+	return d.Prefix + string(kvdb.SuggestedDataPrefix) + string(key)
+}
+func (d *Driver) getCounterKey(key []byte) string {
+	return d.Prefix + string(kvdb.SuggestedCounterPrefix) + string(key)
+}
+
+//Set set value by given key
+func (d *Driver) Set(key []byte, value []byte) error {
+	return convertError(d.Client.Set(d.context(), d.getKey(key), value, 0).Err())
+}
+
+//Get get value by given key
+func (d *Driver) Get(key []byte) ([]byte, error) {
+	data, err := d.Client.Get(d.context(), d.getKey(key)).Bytes()
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return data, nil
+}
+
+//Delete delete value by given key
+func (d *Driver) Delete(key []byte) error {
+	return convertError(d.Client.Del(d.context(), d.getKey(key)).Err())
+}
+
+//SetWithTTL set value by given key and ttl in second
+func (d *Driver) SetWithTTL(key []byte, value []byte, ttlInSecond int64) error {
+	if ttlInSecond <= 0 {
+		return herbdata.ErrInvalidatedTTL
+	}
+	return convertError(d.Client.Set(d.context(), d.getKey(key), value, seconds(ttlInSecond)).Err())
+}
+
+//SetCounter set counter value with given key
+func (d *Driver) SetCounter(key []byte, value int64) error {
+	return convertError(d.Client.Set(d.context(), d.getCounterKey(key), value, 0).Err())
+}
+
+//IncreaseCounter increace counter value with given key and increasement.
+//Value not existed coutn as 0.
+//Return final value and any error if raised.
+func (d *Driver) IncreaseCounter(key []byte, incr int64) (int64, error) {
+	data, err := d.Client.IncrBy(d.context(), d.getCounterKey(key), incr).Result()
+	return data, convertError(err)
+}
+
+//IncreaseCounterWithTTL increace counter value with given key ,increasement,and ttl in second
+//Value not existed coutn as 0.
+//Return final value and any error if raised.
+func (d *Driver) IncreaseCounterWithTTL(key []byte, incr int64, ttlInSecond int64) (int64, error) {
+	if ttlInSecond <= 0 {
+		return 0, herbdata.ErrInvalidatedTTL
+	}
+	k := d.getCounterKey(key)
+	var incrcmd *redis.IntCmd
+	_, err := d.Client.TxPipelined(d.context(), func(pipe redis.Pipeliner) error {
+		incrcmd = pipe.IncrBy(d.context(), k, incr)
+		pipe.Expire(d.context(), k, seconds(ttlInSecond))
+		return nil
+	})
+	if err != nil {
+		return 0, convertError(err)
+	}
+	return incrcmd.Val(), nil
+}
+
+//SetCounterWithTTL set counter value with given key and ttl in second
+func (d *Driver) SetCounterWithTTL(key []byte, value int64, ttlInSecond int64) error {
+	if ttlInSecond <= 0 {
+		return herbdata.ErrInvalidatedTTL
+	}
+	return convertError(d.Client.Set(d.context(), d.getCounterKey(key), value, seconds(ttlInSecond)).Err())
+}
+
+//GetCounter get counter value with given key
+//Value not existed coutn as 0.
+func (d *Driver) GetCounter(key []byte) (int64, error) {
+	data, err := d.Client.Get(d.context(), d.getCounterKey(key)).Int64()
+	err = convertError(err)
+	if err == herbdata.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return data, nil
+}
+
+//DeleteCounter delete counter value with given key
+func (d *Driver) DeleteCounter(key []byte) error {
+	return convertError(d.Client.Del(d.context(), d.getCounterKey(key)).Err())
+}
+
+//Insert insert value with given key.
+//Insert will fail if data with given key exists.
+//Return if operation success and any error if raised
+func (d *Driver) Insert(key []byte, value []byte) (bool, error) {
+	ok, err := d.Client.SetNX(d.context(), d.getKey(key), value, 0).Result()
+	return ok, convertError(err)
+}
+
+//InsertWithTTL insert value with given key and ttl in second.
+//Insert will fail if data with given key exists.
+//Return if operation success and any error if raised
+func (d *Driver) InsertWithTTL(key []byte, value []byte, ttlInSecond int64) (bool, error) {
+	if ttlInSecond <= 0 {
+		return false, herbdata.ErrInvalidatedTTL
+	}
+	ok, err := d.Client.SetNX(d.context(), d.getKey(key), value, seconds(ttlInSecond)).Result()
+	return ok, convertError(err)
+}
+
+//Update update value with given key.
+//Update will fail if data with given key does nto exist.
+//Return if operation success and any error if raised
+func (d *Driver) Update(key []byte, value []byte) (bool, error) {
+	ok, err := d.Client.SetXX(d.context(), d.getKey(key), value, 0).Result()
+	return ok, convertError(err)
+}
+
+//UpdateWithTTL update value with given key and ttl in second.
+//Update will fail if data with given key does nto exist.
+//Return if operation success and any error if raised
+func (d *Driver) UpdateWithTTL(key []byte, value []byte, ttlInSecond int64) (bool, error) {
+	if ttlInSecond <= 0 {
+		return false, herbdata.ErrInvalidatedTTL
+	}
+	ok, err := d.Client.SetXX(d.context(), d.getKey(key), value, seconds(ttlInSecond)).Result()
+	return ok, convertError(err)
+}
+
+//Next return keys after iter not more than given limit
+//Empty iter (nil or 0 length []byte) will start a new search
+//Return keyvalue ,newiter and any error if raised.
+//Empty iter (nil or 0 length []byte) will be returned if no more keys
+//
+//Keys are walked with redis SCAN command,so they are NOT returned in byte order.
+//Keys added or removed during iteration may or may not be returned,
+//and a key may be returned more than once if redis rehashes its dict during iteration.
+//Keys scanned but not returned because of limit are kept in newiter,
+//so newiter may contain up to limit keys.
+//In cluster mode master nodes are scanned one by one in address order.
+//Iter is compatible with redisdb driver.
+func (d *Driver) Next(iter []byte, limit int) (result []*herbdata.KeyValue, newiter []byte, err error) {
+	nodes := []string{""}
+	clients := map[string]redis.Cmdable{"": d.Client}
+	cluster, ok := d.Client.(*redis.ClusterClient)
+	if ok {
+		masters, err := d.masters(cluster)
+		if err != nil {
+			return nil, nil, err
+		}
+		nodes = make([]string, len(masters))
+		for k, v := range masters {
+			nodes[k] = v.Options().Addr
+			clients[nodes[k]] = v
+		}
+	}
+	return redisscan.Next(iter, limit, d.getKey(nil), nodes, func(node string) (redisscan.Client, func()) {
+		return &scanClient{driver: d, client: clients[node]}, func() {}
+	})
+}
+
+//masters return clients of cluster master nodes in address order.
+func (d *Driver) masters(cluster *redis.ClusterClient) ([]*redis.Client, error) {
+	var lock sync.Mutex
+	masters := []*redis.Client{}
+	err := cluster.ForEachMaster(d.context(), func(ctx context.Context, client *redis.Client) error {
+		lock.Lock()
+		masters = append(masters, client)
+		lock.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(masters, func(i, j int) bool {
+		return masters[i].Options().Addr < masters[j].Options().Addr
+	})
+	return masters, nil
+}
+
+//scanClient client which walks keys with given go-redis client.
+type scanClient struct {
+	driver *Driver
+	client redis.Cmdable
+}
+
+//Scan run SCAN command with given cursor,MATCH pattern and COUNT.
+func (c *scanClient) Scan(cursor string, pattern string, count int) (string, []string, error) {
+	current, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return "", nil, ErrInvalidIter
+	}
+	keys, next, err := c.client.Scan(c.driver.context(), current, pattern, int64(count)).Result()
+	if err != nil {
+		return "", nil, convertError(err)
+	}
+	return strconv.FormatUint(next, 10), keys, nil
+}
+
+//Fetch load key-values of given redis keys.
+func (c *scanClient) Fetch(keys []string) ([]*herbdata.KeyValue, error) {
+	return c.driver.fetch(c.client, keys)
+}
+
+//fetch load values of given redis keys with pipelined GET.
+//Keys expired or deleted after scanned will be skipped.
+func (d *Driver) fetch(client redis.Cmdable, keys []string) ([]*herbdata.KeyValue, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := client.Pipelined(d.context(), func(pipe redis.Pipeliner) error {
+		for k := range keys {
+			cmds[k] = pipe.Get(d.context(), keys[k])
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	prefixlen := len(d.getKey(nil))
+	result := make([]*herbdata.KeyValue, 0, len(keys))
+	for k := range keys {
+		value, err := cmds[k].Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &herbdata.KeyValue{
+			Key:   []byte(keys[k][prefixlen:]),
+			Value: value,
+		})
+	}
+	return result, nil
+}
+
+func seconds(ttlInSecond int64) time.Duration {
+	return time.Duration(ttlInSecond) * time.Second
+}
+
+func convertError(err error) error {
+	if err == nil {
+		return err
+	}
+	if err == redis.Nil {
+		return herbdata.ErrNotFound
+	}
+	return err
+}
+
+func new() *Driver {
+	return &Driver{}
+}
+
+//Config go-redis driver config
+type Config struct {
+	//Addresses redis address,or seed addresses of cluster or sentinel nodes.
+	Addresses []string
+	//Cluster connect to redis cluster.
+	//Cluster mode will also be used if more than one address given without MasterName.
+	Cluster bool
+	//MasterName name of master monitored by sentinels.
+	//Sentinel mode will be enabled if MasterName is not empty.
+	MasterName string
+	//SentinelPassword password used to connect sentinels.
+	SentinelPassword string
+	//Username ACL username used to AUTH with password on redis 6+.
+	Username string
+	Password string
+	//Db should be 0 in cluster mode.
+	Db                   int
+	ConnectTimeout       int64
+	ReadTimeoutInSecond  int64
+	WriteTimeoutInSecond int64
+	//PoolSize max connections per node.Default value of go-redis will be used if 0.
+	PoolSize     int
+	MinIdleConns int
+	//ReadOnly send read commands to replicas in cluster mode.
+	ReadOnly bool
+	Prefix   string
+}
+
+//Options convert config to go-redis universal options.
+func (c *Config) Options() *redis.UniversalOptions {
+	return &redis.UniversalOptions{
+		Addrs:                 c.Addresses,
+		DB:                    c.Db,
+		Username:              c.Username,
+		Password:              c.Password,
+		SentinelPassword:      c.SentinelPassword,
+		MasterName:            c.MasterName,
+		DialTimeout:           seconds(c.ConnectTimeout),
+		ReadTimeout:           seconds(c.ReadTimeoutInSecond),
+		WriteTimeout:          seconds(c.WriteTimeoutInSecond),
+		ContextTimeoutEnabled: true,
+		PoolSize:              c.PoolSize,
+		MinIdleConns:          c.MinIdleConns,
+		ReadOnly:              c.ReadOnly,
+	}
+}
+
+//CreateDriver create driver with config
+func (c *Config) CreateDriver() (kvdb.Driver, error) {
+	if c.Cluster && c.MasterName != "" {
+		return nil, ErrClusterWithSentinel
+	}
+	d := new()
+	d.Prefix = c.Prefix
+	if c.Cluster {
+		d.Client = redis.NewClusterClient(c.Options().Cluster())
+		return d, nil
+	}
+	d.Client = redis.NewUniversalClient(c.Options())
+	return d, nil
+}
+
+//Factory driver factory
+func Factory(loader func(v interface{}) error) (kvdb.Driver, error) {
+	c := &Config{}
+	err := loader(c)
+	if err != nil {
+		return nil, err
+	}
+	return c.CreateDriver()
+}
+
+func init() {
+	kvdb.Register("goredis", Factory)
+}
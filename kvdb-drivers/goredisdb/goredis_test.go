@@ -0,0 +1,220 @@
+package goredisdb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/herb-go/herbdata"
+	"github.com/herb-go/herbdata-drivers/kvdb-drivers/internal/redisscan"
+	"github.com/herb-go/herbdata-drivers/kvdb-drivers/redisdb"
+	"github.com/herb-go/herbdata/kvdb"
+	"github.com/herb-go/herbdata/kvdb/featuretestutil"
+)
+
+func newTestDriver(m *miniredis.Miniredis, cluster bool) *Driver {
+	c := &Config{
+		Addresses: []string{m.Addr()},
+		Cluster:   cluster,
+		Password:  "password",
+		Prefix:    "goredis",
+	}
+	d, err := c.CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	return d.(*Driver)
+}
+
+func TestDriver(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.RequireAuth("password")
+	featuretestutil.TestDriver(func() kvdb.Driver {
+		m.FlushAll()
+		return newTestDriver(m, false)
+	},
+		func(args ...interface{}) { fmt.Println(args...); panic("fatal") })
+}
+
+func TestClusterDriver(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.RequireAuth("password")
+	featuretestutil.TestDriver(func() kvdb.Driver {
+		m.FlushAll()
+		return newTestDriver(m, true)
+	},
+		func(args ...interface{}) { fmt.Println(args...); panic("fatal") })
+}
+
+func newTestRedisDriver(m *miniredis.Miniredis) *redisdb.Driver {
+	c := &redisdb.Config{}
+	c.Network = "tcp"
+	c.Address = m.Addr()
+	c.Password = "password"
+	c.MaxIdle = 10
+	c.Prefix = "goredis"
+	d, err := c.CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	return d.(*redisdb.Driver)
+}
+
+func TestRedisDriverInterop(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.RequireAuth("password")
+	d := newTestDriver(m, false)
+	defer d.Close()
+	r := newTestRedisDriver(m)
+	defer r.Close()
+	err := r.Set([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := d.Get([]byte("key"))
+	if err != nil || string(value) != "value" {
+		t.Fatal(string(value), err)
+	}
+	_, err = r.IncreaseCounter([]byte("key"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter, err := d.GetCounter([]byte("key"))
+	if err != nil || counter != 2 {
+		t.Fatal(counter, err)
+	}
+	err = d.Set([]byte("shared"), []byte("sharedvalue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err = r.Get([]byte("shared"))
+	if err != nil || string(value) != "sharedvalue" {
+		t.Fatal(string(value), err)
+	}
+	_, err = d.IncreaseCounter([]byte("shared"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter, err = r.GetCounter([]byte("shared"))
+	if err != nil || counter != 3 {
+		t.Fatal(counter, err)
+	}
+	for i := 0; i < 10; i++ {
+		err = r.Set([]byte("next"+strconv.Itoa(i)), []byte("value"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	//iter created by one driver can be used by another
+	found := map[string]bool{}
+	result, iter, err := r.Next(nil, 5)
+	if err != nil || len(iter) == 0 {
+		t.Fatal(err, iter)
+	}
+	for _, v := range result {
+		found[string(v.Key)] = true
+	}
+	for len(iter) != 0 {
+		result, iter, err = d.Next(iter, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range result {
+			found[string(v.Key)] = true
+		}
+	}
+	if len(found) != 12 {
+		t.Fatal(found)
+	}
+}
+
+func testNext(t *testing.T, d *Driver) {
+	for i := 0; i < 25; i++ {
+		err := d.Set([]byte("key"+strconv.Itoa(i)), []byte("value"+strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := d.IncreaseCounter([]byte("counter"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]string{}
+	var iter []byte
+	for {
+		var result []*herbdata.KeyValue
+		result, iter, err = d.Next(iter, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result) > 7 {
+			t.Fatal(len(result))
+		}
+		for _, v := range result {
+			found[string(v.Key)] = string(v.Value)
+		}
+		if len(iter) == 0 {
+			break
+		}
+	}
+	if len(found) != 25 {
+		t.Fatal(found)
+	}
+	for k, v := range found {
+		if "value"+k[3:] != v {
+			t.Fatal(k, v)
+		}
+	}
+	_, _, err = d.Next([]byte("invalid"), 10)
+	if err != ErrInvalidIter {
+		t.Fatal(err)
+	}
+}
+
+func TestNext(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.RequireAuth("password")
+	d := newTestDriver(m, false)
+	defer d.Close()
+	testNext(t, d)
+	_, _, err := d.Next(redisscan.EncodeIter("0", nil, "127.0.0.1:1"), 10)
+	if err != ErrInvalidIter {
+		t.Fatal(err)
+	}
+}
+
+func TestClusterNext(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.RequireAuth("password")
+	d := newTestDriver(m, true)
+	defer d.Close()
+	testNext(t, d)
+	_, _, err := d.Next(redisscan.EncodeIter("0", nil, "127.0.0.1:1"), 10)
+	if err != ErrInvalidIter {
+		t.Fatal(err)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.RequireAuth("password")
+	d := newTestDriver(m, false)
+	defer d.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := d.WithContext(ctx).Set([]byte("key"), []byte("value"))
+	if err != context.Canceled {
+		t.Fatal(err)
+	}
+	_, err = d.Get([]byte("key"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	c := &Config{Cluster: true, MasterName: "mymaster"}
+	_, err = c.CreateDriver()
+	if err != ErrClusterWithSentinel {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,175 @@
+//Package redisscan walks keys of redis based drivers with SCAN command.
+//Drivers sharing same key layout share iter format,so iter created by one driver can be used by another.
+package redisscan
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/herb-go/herbdata"
+	"github.com/herb-go/herbdata/kvdb"
+)
+
+//ErrInvalidIter error raised if iter passed to Next is not created by redis drivers
+var ErrInvalidIter = errors.New("redis: invalid iter")
+
+//Client commands used to walk keys on one redis node.
+type Client interface {
+	//Scan run SCAN command with given cursor,MATCH pattern and COUNT.
+	//Return next cursor,keys and any error if raised.
+	Scan(cursor string, pattern string, count int) (string, []string, error)
+	//Fetch load key-values of given redis keys.
+	//Keys expired or deleted after scanned should be skipped.
+	Fetch(keys []string) ([]*herbdata.KeyValue, error)
+}
+
+//Next walk redis keys with given prefix after iter not more than given limit.
+//Nodes are walked one by one,and should be sorted and stable between calls.
+//Nodes should be []string{""} if server is not a cluster.
+//Client of node is created by open,and released by returned function after used.
+//Keys scanned but not returned because of limit are kept in newiter,
+//so newiter may contain up to limit keys.
+//Return keyvalue ,newiter and any error if raised.
+//Empty iter (nil or 0 length []byte) will be returned if no more keys
+func Next(iter []byte, limit int, prefix string, nodes []string, open func(node string) (Client, func())) (result []*herbdata.KeyValue, newiter []byte, err error) {
+	if limit <= 0 {
+		return nil, nil, kvdb.ErrUnsupportedNextLimit
+	}
+	cursor, pending, node, err := DecodeIter(iter)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, v := range pending {
+		if !strings.HasPrefix(v, prefix) {
+			return nil, nil, ErrInvalidIter
+		}
+	}
+	var start int
+	if len(iter) > 0 {
+		start = sort.SearchStrings(nodes, node)
+		if start == len(nodes) || nodes[start] != node {
+			return nil, nil, ErrInvalidIter
+		}
+	}
+	for i := start; i < len(nodes); i++ {
+		var done bool
+		client, release := open(nodes[i])
+		result, cursor, pending, done, err = scan(client, EscapePattern(prefix)+"*", cursor, pending, limit, result)
+		release()
+		if err != nil {
+			return nil, nil, err
+		}
+		if !done {
+			return result, EncodeIter(cursor, pending, nodes[i]), nil
+		}
+		cursor, pending = "0", nil
+		if len(result) >= limit && i+1 < len(nodes) {
+			return result, EncodeIter(cursor, pending, nodes[i+1]), nil
+		}
+	}
+	return result, nil, nil
+}
+
+//scan fetch pending keys and scan keys from cursor with given client until result reach limit or all keys are scanned.
+//Cursor is empty if all keys are scanned but some of them are still pending.
+//Return result,new cursor,keys scanned but not fetched yet,if scan is finished and any error if raised.
+func scan(client Client, pattern string, cursor string, pending []string, limit int, result []*herbdata.KeyValue) ([]*herbdata.KeyValue, string, []string, bool, error) {
+	for {
+		need := limit - len(result)
+		if len(pending) > need {
+			data, err := client.Fetch(pending[:need])
+			if err != nil {
+				return nil, "", nil, false, err
+			}
+			//rest of SCAN batch is kept,so that keys will not be lost or duplicated if resuming from cursor.
+			return append(result, data...), cursor, pending[need:], false, nil
+		}
+		if len(pending) > 0 {
+			data, err := client.Fetch(pending)
+			if err != nil {
+				return nil, "", nil, false, err
+			}
+			result = append(result, data...)
+			pending = nil
+		}
+		if cursor == "" {
+			return result, "", nil, true, nil
+		}
+		if len(result) >= limit {
+			return result, cursor, nil, false, nil
+		}
+		next, keys, err := client.Scan(cursor, pattern, limit)
+		if err != nil {
+			return nil, "", nil, false, err
+		}
+		pending = keys
+		cursor = next
+		if cursor == "0" {
+			cursor = ""
+		}
+	}
+}
+
+//EncodeIter encode redis scan cursor,keys scanned but not returned yet and cluster node address into iter.
+//Cursor should be empty if node is scanned to end.
+//Iter is a list of uvarint length prefixed fields,including cursor,node and pending keys.
+func EncodeIter(cursor string, pending []string, node string) []byte {
+	fields := append([]string{cursor, node}, pending...)
+	buf := make([]byte, binary.MaxVarintLen64)
+	var iter []byte
+	for _, v := range fields {
+		n := binary.PutUvarint(buf, uint64(len(v)))
+		iter = append(iter, buf[:n]...)
+		iter = append(iter, v...)
+	}
+	return iter
+}
+
+//DecodeIter decode iter into redis scan cursor,keys scanned but not returned yet and cluster node address.
+//Cursor "0" will be returned for empty iter.
+func DecodeIter(iter []byte) (cursor string, pending []string, node string, err error) {
+	if len(iter) == 0 {
+		return "0", nil, "", nil
+	}
+	var fields []string
+	for len(iter) > 0 {
+		l, n := binary.Uvarint(iter)
+		if n <= 0 || l > uint64(len(iter)-n) {
+			return "", nil, "", ErrInvalidIter
+		}
+		fields = append(fields, string(iter[n:n+int(l)]))
+		iter = iter[n+int(l):]
+	}
+	if len(fields) < 2 {
+		return "", nil, "", ErrInvalidIter
+	}
+	cursor, node, pending = fields[0], fields[1], fields[2:]
+	if cursor == "" {
+		//scan finished with no pending keys should not be encoded
+		if len(pending) == 0 {
+			return "", nil, "", ErrInvalidIter
+		}
+	} else {
+		_, err = strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return "", nil, "", ErrInvalidIter
+		}
+	}
+	return cursor, pending, node, nil
+}
+
+var patternReplacer = strings.NewReplacer(
+	"\\", "\\\\",
+	"*", "\\*",
+	"?", "\\?",
+	"[", "\\[",
+	"]", "\\]",
+)
+
+//EscapePattern escape glob-style special characters so that s can be used in SCAN MATCH pattern literally.
+func EscapePattern(s string) string {
+	return patternReplacer.Replace(s)
+}
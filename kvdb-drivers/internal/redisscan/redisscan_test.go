@@ -0,0 +1,40 @@
+package redisscan
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIter(t *testing.T) {
+	iter := EncodeIter("123", []string{"key1", "", "key:2"}, "127.0.0.1:7001")
+	cursor, pending, node, err := DecodeIter(iter)
+	if err != nil || cursor != "123" || strings.Join(pending, ",") != "key1,,key:2" || node != "127.0.0.1:7001" {
+		t.Fatal(cursor, pending, node, err)
+	}
+	cursor, pending, node, err = DecodeIter(nil)
+	if err != nil || cursor != "0" || pending != nil || node != "" {
+		t.Fatal(cursor, pending, node, err)
+	}
+	cursor, pending, _, err = DecodeIter(EncodeIter("", []string{"key"}, ""))
+	if err != nil || cursor != "" || len(pending) != 1 {
+		t.Fatal(cursor, pending, err)
+	}
+	for _, v := range [][]byte{
+		[]byte("invalid"),
+		EncodeIter("", nil, ""),
+		EncodeIter("cursor", nil, ""),
+		iter[:len(iter)-1],
+		{0x80},
+	} {
+		_, _, _, err = DecodeIter(v)
+		if err != ErrInvalidIter {
+			t.Fatal(v, err)
+		}
+	}
+}
+
+func TestEscapePattern(t *testing.T) {
+	if EscapePattern(`a*b?c[d]e\`) != `a\*b\?c\[d\]e\\` {
+		t.Fatal(EscapePattern(`a*b?c[d]e\`))
+	}
+}
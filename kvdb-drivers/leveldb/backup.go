@@ -0,0 +1,315 @@
+package leveldb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+//ErrInvalidBackup error raised if backup is invalid or truncated.
+var ErrInvalidBackup = errors.New("leveldb: invalid backup")
+
+//backupHeader magic bytes and format version written at start of backup stream.
+var backupHeader = []byte{'h', 'l', 'd', 'b', 1}
+
+//maxBackupEntrySize max size of key or value in backup stream.
+const maxBackupEntrySize = 1 << 30
+
+//writeBatchSize count of operations written in one batch by bulk operations.
+const writeBatchSize = 1000
+
+//Backup write consistent snapshot of whole database to given writer.
+//All keys are written,including counters and expiry index,
+//and backup can be restored with Restore.
+//
+//Backup stream starts with a header,followed by entries of flag byte 1,uvarint length prefixed key and value,
+//and ends with flag byte 0 and big endian crc32 checksum of all bytes before.
+func (d *Driver) Backup(w io.Writer) error {
+	s, err := d.DB.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer s.Release()
+	it := s.NewIterator(nil, nil)
+	defer it.Release()
+	h := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, h))
+	_, err = bw.Write(backupHeader)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	writeBytes := func(data []byte) error {
+		n := binary.PutUvarint(buf, uint64(len(data)))
+		_, err := bw.Write(buf[:n])
+		if err != nil {
+			return err
+		}
+		_, err = bw.Write(data)
+		return err
+	}
+	for it.Next() {
+		err = bw.WriteByte(1)
+		if err != nil {
+			return err
+		}
+		err = writeBytes(it.Key())
+		if err != nil {
+			return err
+		}
+		err = writeBytes(it.Value())
+		if err != nil {
+			return err
+		}
+	}
+	err = it.Error()
+	if err != nil {
+		return err
+	}
+	err = bw.WriteByte(0)
+	if err != nil {
+		return err
+	}
+	err = bw.Flush()
+	if err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, h.Sum32())
+}
+
+//backupReader reader which updates checksum with consumed bytes.
+type backupReader struct {
+	r *bufio.Reader
+	h hash.Hash32
+}
+
+func (r *backupReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	r.h.Write([]byte{b})
+	return b, nil
+}
+
+func (r *backupReader) readBytes() ([]byte, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if l > maxBackupEntrySize {
+		return nil, ErrInvalidBackup
+	}
+	data := make([]byte, l)
+	_, err = io.ReadFull(r.r, data)
+	if err != nil {
+		return nil, err
+	}
+	r.h.Write(data)
+	return data, nil
+}
+
+//Restore write all keys in backup created by Backup into database.
+//Existing keys not in backup are kept,so backup should be restored into an empty database to get an exact copy.
+//Backup is staged in a temporary file and verified with checksum before any key written,
+//so database will not be changed if ErrInvalidBackup returned.
+func (d *Driver) Restore(r io.Reader) error {
+	if d.readOnly() {
+		return ErrReadOnly
+	}
+	f, err := ioutil.TempFile("", "leveldb-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	err = readBackup(io.TeeReader(r, f), func(key []byte, value []byte) error {
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	b := d.newBulkWriter()
+	err = readBackup(f, b.put)
+	if err != nil {
+		return err
+	}
+	return b.flush()
+}
+
+//readBackup read entries in backup stream and call given function with every key and value.
+//ErrInvalidBackup will be returned if backup is invalid,truncated or checksum mismatched.
+func readBackup(r io.Reader, f func(key []byte, value []byte) error) error {
+	br := &backupReader{r: bufio.NewReader(r), h: crc32.NewIEEE()}
+	header := make([]byte, len(backupHeader))
+	_, err := io.ReadFull(br.r, header)
+	if err != nil {
+		return convertBackupError(err)
+	}
+	if string(header) != string(backupHeader) {
+		return ErrInvalidBackup
+	}
+	br.h.Write(header)
+	for {
+		flag, err := br.ReadByte()
+		if err != nil {
+			return convertBackupError(err)
+		}
+		if flag == 0 {
+			break
+		}
+		if flag != 1 {
+			return ErrInvalidBackup
+		}
+		key, err := br.readBytes()
+		if err != nil {
+			return convertBackupError(err)
+		}
+		value, err := br.readBytes()
+		if err != nil {
+			return convertBackupError(err)
+		}
+		err = f(key, value)
+		if err != nil {
+			return err
+		}
+	}
+	var sum uint32
+	err = binary.Read(br.r, binary.BigEndian, &sum)
+	if err != nil {
+		return convertBackupError(err)
+	}
+	if sum != br.h.Sum32() {
+		return ErrInvalidBackup
+	}
+	return nil
+}
+
+func convertBackupError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrInvalidBackup
+	}
+	return err
+}
+
+//BackupToDir write consistent snapshot of whole database into a new leveldb database in given directory.
+//Backup database can be opened by driver directly or restored with RestoreFromDir.
+//Backup will fail if database already exists in directory.
+func (d *Driver) BackupToDir(dir string) error {
+	s, err := d.DB.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer s.Release()
+	db, err := leveldb.OpenFile(dir, &opt.Options{ErrorIfExist: true})
+	if err != nil {
+		return err
+	}
+	it := s.NewIterator(nil, nil)
+	defer it.Release()
+	err = copyEntries(it, func(b *leveldb.Batch, keys [][]byte) error {
+		return db.Write(b, nil)
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
+
+//RestoreFromDir write all keys in leveldb database in given directory into database.
+//Existing keys not in backup are kept,so backup should be restored into an empty database to get an exact copy.
+func (d *Driver) RestoreFromDir(dir string) error {
+	if d.readOnly() {
+		return ErrReadOnly
+	}
+	db, err := leveldb.OpenFile(dir, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	return copyEntries(it, d.writeBatch)
+}
+
+//copyEntries write all entries of given iterator with given function in batches.
+func copyEntries(it iterator.Iterator, write func(b *leveldb.Batch, keys [][]byte) error) error {
+	w := &bulkWriter{batch: new(leveldb.Batch), write: write}
+	for it.Next() {
+		err := w.put(it.Key(), it.Value())
+		if err != nil {
+			return err
+		}
+	}
+	err := it.Error()
+	if err != nil {
+		return err
+	}
+	return w.flush()
+}
+
+//bulkWriter writer which writes entries in batches of writeBatchSize.
+type bulkWriter struct {
+	batch *leveldb.Batch
+	keys  [][]byte
+	write func(b *leveldb.Batch, keys [][]byte) error
+	//written count of operations written.
+	written int
+}
+
+func (d *Driver) newBulkWriter() *bulkWriter {
+	return &bulkWriter{batch: new(leveldb.Batch), write: d.writeBatch}
+}
+
+func (w *bulkWriter) put(key []byte, value []byte) error {
+	w.batch.Put(key, value)
+	w.keys = append(w.keys, append([]byte{}, key...))
+	if w.batch.Len() < writeBatchSize {
+		return nil
+	}
+	return w.flush()
+}
+
+func (w *bulkWriter) delete(key []byte) error {
+	w.batch.Delete(key)
+	w.keys = append(w.keys, append([]byte{}, key...))
+	if w.batch.Len() < writeBatchSize {
+		return nil
+	}
+	return w.flush()
+}
+
+func (w *bulkWriter) flush() error {
+	if w.batch.Len() == 0 {
+		return nil
+	}
+	err := w.write(w.batch, w.keys)
+	if err != nil {
+		return err
+	}
+	w.written = w.written + w.batch.Len()
+	w.batch.Reset()
+	w.keys = nil
+	return nil
+}
+
+//writeBatch write given batch with keys locked.
+func (d *Driver) writeBatch(b *leveldb.Batch, keys [][]byte) error {
+	unlock := d.locks.lockKeys(keys)
+	defer unlock()
+	return d.DB.Write(b, nil)
+}
@@ -0,0 +1,79 @@
+package leveldb
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+//Batch write batch which collects Set and Delete operations,
+//and commits them atomically with leveldb.Batch.
+//Batch is not safe for concurrent use.
+//Operations on keys starting with byte 1 or 2 are not added,
+//and ErrReservedKey will be returned by Commit.
+type Batch struct {
+	driver *Driver
+	batch  *leveldb.Batch
+	keys   [][]byte
+	err    error
+}
+
+//NewBatch create new empty write batch.
+func (d *Driver) NewBatch() *Batch {
+	return &Batch{
+		driver: d,
+		batch:  new(leveldb.Batch),
+	}
+}
+
+//Set set value by given key when batch committed.
+func (b *Batch) Set(key []byte, value []byte) {
+	if isReservedKey(key) {
+		b.err = ErrReservedKey
+		return
+	}
+	b.batch.Put(key, encodeValue(value, 0))
+	b.keys = append(b.keys, append([]byte{}, key...))
+}
+
+//Delete delete value by given key when batch committed.
+func (b *Batch) Delete(key []byte) {
+	if isReservedKey(key) {
+		b.err = ErrReservedKey
+		return
+	}
+	b.batch.Delete(key)
+	b.keys = append(b.keys, append([]byte{}, key...))
+}
+
+//Len return count of operations in batch.
+func (b *Batch) Len() int {
+	return b.batch.Len()
+}
+
+//Reset remove all operations in batch.
+func (b *Batch) Reset() {
+	b.batch.Reset()
+	b.keys = nil
+	b.err = nil
+}
+
+//Commit write all operations in batch atomically.
+//Write will be synced to disk before returning if sync is true.
+//Nothing will be written if any operation used reserved key,and ErrReservedKey will be returned.
+//Batch can be reused after Reset.
+func (b *Batch) Commit(sync bool) error {
+	d := b.driver
+	if d.readOnly() {
+		return ErrReadOnly
+	}
+	if b.err != nil {
+		return b.err
+	}
+	if b.batch.Len() == 0 {
+		return nil
+	}
+	//keys are locked so that batch will not interleave with Insert and Update
+	unlock := d.locks.lockKeys(b.keys)
+	defer unlock()
+	return d.DB.Write(b.batch, &opt.WriteOptions{Sync: sync})
+}
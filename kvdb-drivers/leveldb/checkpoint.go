@@ -0,0 +1,336 @@
+package leveldb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb/journal"
+)
+
+//ErrCheckpointChanged error raised if database kept changing while creating read-only checkpoint.
+var ErrCheckpointChanged = errors.New("leveldb: database changed while creating checkpoint")
+
+//errInvalidManifest error raised if copied manifest can not be decoded.
+var errInvalidManifest = errors.New("leveldb: invalid manifest")
+
+//checkpointRetries max times to retry creating checkpoint if database changed.
+const checkpointRetries = 10
+
+//currentFile file which contains name of current manifest.
+const currentFile = "CURRENT"
+
+//Manifest record fields written by goleveldb.
+const (
+	manifestComparer       = 1
+	manifestJournalNum     = 2
+	manifestNextFileNum    = 3
+	manifestSeqNum         = 4
+	manifestCompPtr        = 5
+	manifestDelTable       = 6
+	manifestAddTable       = 7
+	manifestPrevJournalNum = 9
+)
+
+//manifestState database state decoded from manifest.
+type manifestState struct {
+	//tables live tables keyed by level and table number.
+	tables         map[[2]uint64]bool
+	journalNum     uint64
+	prevJournalNum uint64
+	nextFileNum    uint64
+}
+
+//tableNums return numbers of live tables.
+func (s *manifestState) tableNums() []uint64 {
+	result := make([]uint64, 0, len(s.tables))
+	for k := range s.tables {
+		result = append(result, k[1])
+	}
+	return result
+}
+
+//manifestReader reader of manifest record fields,
+//which keeps first error raised.
+type manifestReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (m *manifestReader) uvarint() uint64 {
+	if m.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(m.r)
+	if err != nil {
+		m.err = errInvalidManifest
+	}
+	return v
+}
+
+func (m *manifestReader) varint() uint64 {
+	v := m.uvarint()
+	if v > math.MaxInt64 {
+		m.err = errInvalidManifest
+	}
+	return v
+}
+
+func (m *manifestReader) skipBytes() {
+	l := m.uvarint()
+	if m.err != nil {
+		return
+	}
+	if l > uint64(m.r.Len()) {
+		m.err = errInvalidManifest
+		return
+	}
+	m.r.Seek(int64(l), io.SeekCurrent)
+}
+
+//decode apply given manifest record to state.
+func (s *manifestState) decode(data []byte) error {
+	m := &manifestReader{r: bytes.NewReader(data)}
+	for m.r.Len() > 0 && m.err == nil {
+		switch m.uvarint() {
+		case manifestComparer:
+			m.skipBytes()
+		case manifestJournalNum:
+			s.journalNum = m.varint()
+		case manifestPrevJournalNum:
+			s.prevJournalNum = m.varint()
+		case manifestNextFileNum:
+			s.nextFileNum = m.varint()
+		case manifestSeqNum:
+			m.uvarint()
+		case manifestCompPtr:
+			m.uvarint()
+			m.skipBytes()
+		case manifestAddTable:
+			level := m.uvarint()
+			num := m.varint()
+			m.varint()
+			m.skipBytes()
+			m.skipBytes()
+			if m.err == nil {
+				s.tables[[2]uint64{level, num}] = true
+			}
+		case manifestDelTable:
+			level := m.uvarint()
+			num := m.varint()
+			if m.err == nil {
+				delete(s.tables, [2]uint64{level, num})
+			}
+		default:
+			m.err = errInvalidManifest
+		}
+	}
+	return m.err
+}
+
+//readManifestState decode database state from manifest file in given path.
+//errInvalidManifest will be returned if manifest is corrupted or truncated.
+func readManifestState(path string) (*manifestState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := &manifestState{tables: map[[2]uint64]bool{}}
+	jr := journal.NewReader(f, nil, true, true)
+	for {
+		r, err := jr.Next()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return nil, errInvalidManifest
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, errInvalidManifest
+		}
+		err = s.decode(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+//readManifest return current manifest name and size of database in given path.
+func readManifest(path string) (string, int64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(path, currentFile))
+	if err != nil {
+		return "", 0, err
+	}
+	name := strings.TrimSpace(string(data))
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", 0, ErrCheckpointChanged
+	}
+	info, err := os.Stat(filepath.Join(path, name))
+	if err != nil {
+		return "", 0, err
+	}
+	return name, info.Size(), nil
+}
+
+//copyFile copy at most size bytes of src file to dst.
+//Whole file will be copied if size is negative.
+//Return copied size and any error if raised.
+func copyFile(src string, dst string, size int64) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, err
+	}
+	var r io.Reader = in
+	if size >= 0 {
+		r = io.LimitReader(in, size)
+	}
+	n, err := io.Copy(out, r)
+	if err != nil {
+		out.Close()
+		return 0, err
+	}
+	return n, out.Close()
+}
+
+//linkTable hard link table file with given number in src to dst,or copy it if link failed.
+//Table files are never modified after written,so linked files are safe to read after removed from src.
+//Return if table exists in src and any error if raised.
+func linkTable(src string, dst string, num uint64) (bool, error) {
+	for _, ext := range []string{".ldb", ".sst"} {
+		name := fmt.Sprintf("%06d%s", num, ext)
+		err := os.Link(filepath.Join(src, name), filepath.Join(dst, name))
+		if err == nil {
+			return true, nil
+		}
+		_, err = copyFile(filepath.Join(src, name), filepath.Join(dst, name), -1)
+		if err == nil {
+			return true, nil
+		}
+		os.Remove(filepath.Join(dst, name))
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+//journalNum return number of journal file with given name.
+func journalNum(name string) (uint64, bool) {
+	if !strings.HasSuffix(name, ".log") {
+		return 0, false
+	}
+	num, err := strconv.ParseUint(strings.TrimSuffix(name, ".log"), 10, 63)
+	if err != nil {
+		return 0, false
+	}
+	return num, true
+}
+
+//copyCheckpoint copy files needed to open database in src to dst.
+//Only tables referred by copied manifest are linked,
+//and all of them are numbered before next file number in manifest,
+//so files created by checkpoint database never reuse names of linked tables.
+//Return if consistent checkpoint created and any error if raised.
+func copyCheckpoint(src string, dst string) (bool, error) {
+	manifest, size, err := readManifest(src)
+	if err != nil {
+		return false, err
+	}
+	copied, err := copyFile(filepath.Join(src, manifest), filepath.Join(dst, manifest), size)
+	if err != nil {
+		return false, err
+	}
+	if copied != size {
+		return false, nil
+	}
+	state, err := readManifestState(filepath.Join(dst, manifest))
+	if err == errInvalidManifest {
+		//manifest may be copied while record being appended
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, num := range state.tableNums() {
+		if num >= state.nextFileNum {
+			return false, errInvalidManifest
+		}
+		//tables referred by copied manifest may be removed after compaction committed
+		ok, err := linkTable(src, dst, num)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return false, err
+	}
+	var current bool
+	for _, v := range files {
+		num, ok := journalNum(v.Name())
+		if !ok || (num < state.journalNum && num != state.prevJournalNum) {
+			continue
+		}
+		_, err = copyFile(filepath.Join(src, v.Name()), filepath.Join(dst, v.Name()), -1)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if num == state.journalNum {
+			current = true
+		}
+	}
+	//journal referred by manifest may be removed after memdb flushed
+	if state.journalNum != 0 && !current {
+		return false, nil
+	}
+	err = ioutil.WriteFile(filepath.Join(dst, currentFile), []byte(manifest+"\n"), 0644)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//createCheckpoint create checkpoint of database in given path in a new temporary directory.
+//Database can be owned and written by other process while creating checkpoint,
+//live table files are hard linked if possible and other files are copied.
+//Return checkpoint path and any error if raised.
+func createCheckpoint(path string) (string, error) {
+	var lasterr error = ErrCheckpointChanged
+	for i := 0; i < checkpointRetries; i++ {
+		dir, err := ioutil.TempDir("", "leveldb-checkpoint-")
+		if err != nil {
+			return "", err
+		}
+		ok, err := copyCheckpoint(path, dir)
+		if err == nil && ok {
+			return dir, nil
+		}
+		os.RemoveAll(dir)
+		//files may be removed by database owner while copying
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+			lasterr = err
+		}
+	}
+	return "", lasterr
+}
@@ -0,0 +1,70 @@
+package leveldb
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+//Compact compact underlying storage of keys in given range.
+//Whole database will be compacted if range is nil.
+//Deleted and overwritten values are discarded while compacting.
+func (d *Driver) Compact(r *util.Range) error {
+	if d.readOnly() {
+		return ErrReadOnly
+	}
+	if r == nil {
+		r = &util.Range{}
+	}
+	return d.DB.CompactRange(*r)
+}
+
+//Property return value of given goleveldb property.
+//Properties include "leveldb.stats","leveldb.sstables","leveldb.num-files-at-level{n}",
+//"leveldb.blockpool","leveldb.cachedblock","leveldb.openedtables" and "leveldb.alivesnaps".
+func (d *Driver) Property(name string) (string, error) {
+	return d.DB.GetProperty(name)
+}
+
+//Stats return database statistics,including sstable counts and sizes of each level.
+func (d *Driver) Stats() (*leveldb.DBStats, error) {
+	stats := &leveldb.DBStats{}
+	err := d.DB.Stats(stats)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+//SizeOf return approximate file system space used by keys in given range.
+//Whole database will be measured if range is nil.
+//Values still in memtable are not counted.
+func (d *Driver) SizeOf(r *util.Range) (int64, error) {
+	if r == nil {
+		r = &util.Range{}
+	}
+	if r.Limit != nil {
+		sizes, err := d.DB.SizeOf([]util.Range{*r})
+		if err != nil {
+			return 0, err
+		}
+		return sizes.Sum(), nil
+	}
+	//goleveldb measures nil limit as the smallest key,
+	//so size of unbounded range is total size minus size before range start.
+	stats, err := d.Stats()
+	if err != nil {
+		return 0, err
+	}
+	size := stats.LevelSizes.Sum()
+	if r.Start != nil {
+		sizes, err := d.DB.SizeOf([]util.Range{{Limit: r.Start}})
+		if err != nil {
+			return 0, err
+		}
+		size = size - sizes.Sum()
+	}
+	if size < 0 {
+		return 0, nil
+	}
+	return size, nil
+}
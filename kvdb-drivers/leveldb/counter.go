@@ -0,0 +1,100 @@
+package leveldb
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/herb-go/herbdata/kvdb"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+//ErrInvalidCounterValue error raised if stored counter value is not a 8 bytes int64.
+var ErrInvalidCounterValue = errors.New("leveldb: invalid counter value")
+
+//counterPrefix prefix of keys which counters are stored with.
+var counterPrefix = []byte{kvdb.SuggestedCounterPrefix}
+
+func getCounterKey(key []byte) []byte {
+	return append(append([]byte{}, counterPrefix...), key...)
+}
+
+func encodeCounter(value int64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(value))
+	return data
+}
+
+func decodeCounter(data []byte) (int64, error) {
+	if len(data) != 8 {
+		return 0, ErrInvalidCounterValue
+	}
+	return int64(binary.BigEndian.Uint64(data)), nil
+}
+
+//SetCounter set counter value with given key
+func (d *Driver) SetCounter(key []byte, value int64) error {
+	if d.readOnly() {
+		return ErrReadOnly
+	}
+	k := getCounterKey(key)
+	l := d.locks.get(k)
+	l.Lock()
+	defer l.Unlock()
+	return d.DB.Put(k, encodeCounter(value), nil)
+}
+
+//IncreaseCounter increace counter value with given key and increasement.
+//Value not existed coutn as 0.
+//Return final value and any error if raised.
+func (d *Driver) IncreaseCounter(key []byte, incr int64) (int64, error) {
+	if d.readOnly() {
+		return 0, ErrReadOnly
+	}
+	k := getCounterKey(key)
+	l := d.locks.get(k)
+	l.Lock()
+	defer l.Unlock()
+	v, err := d.getCounter(k)
+	if err != nil {
+		return 0, err
+	}
+	v = v + incr
+	err = d.DB.Put(k, encodeCounter(v), nil)
+	if err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+//GetCounter get counter value with given key
+//Value not existed coutn as 0.
+func (d *Driver) GetCounter(key []byte) (int64, error) {
+	return d.getCounter(getCounterKey(key))
+}
+
+func (d *Driver) getCounter(k []byte) (int64, error) {
+	data, err := d.DB.Get(k, nil)
+	if err == leveldb.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return decodeCounter(data)
+}
+
+//DeleteCounter delete counter value with given key
+func (d *Driver) DeleteCounter(key []byte) error {
+	if d.readOnly() {
+		return ErrReadOnly
+	}
+	k := getCounterKey(key)
+	l := d.locks.get(k)
+	l.Lock()
+	defer l.Unlock()
+	err := d.DB.Delete(k, nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	}
+	return err
+}
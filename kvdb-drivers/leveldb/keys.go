@@ -0,0 +1,80 @@
+package leveldb
+
+import (
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+//NextKeys return keys after iter not more than given limit without values
+//Empty iter (nil or 0 length []byte) will start a new search
+//Return keys ,newiter and any error if raised.
+//Empty iter (nil or 0 length []byte) will be returned if no more keys
+//Iter is compatible with Next.
+func (d *Driver) NextKeys(iter []byte, limit int) (keys [][]byte, newiter []byte, err error) {
+	return d.scanKeys(iter, limit, false)
+}
+
+//PrevKeys return keys before iter not more than given limit without values
+//Empty iter (nil or 0 length []byte) will start a new search
+//Return keys ,newiter and any error if raised.
+//Empty iter (nil or 0 length []byte) will be returned if no more keys
+//Iter is compatible with Prev.
+func (d *Driver) PrevKeys(iter []byte, limit int) (keys [][]byte, newiter []byte, err error) {
+	return d.scanKeys(iter, limit, true)
+}
+
+func (d *Driver) scanKeys(iter []byte, limit int, reverse bool) (keys [][]byte, newiter []byte, err error) {
+	newiter, err = scan(d.DB, nil, iter, limit, reverse, func(key []byte, value []byte) {
+		keys = append(keys, append([]byte{}, key...))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys, newiter, nil
+}
+
+//DeleteRange delete all values in given range in batches.
+//Range start is inclusive and range limit is exclusive,nil start or limit means unbounded.
+//Counters are not deleted,and expired values not swept yet are deleted and counted.
+//Values written after DeleteRange started may not be deleted.
+//Return count of deleted values and any error if raised.
+//Values in batches written before error raised are deleted.
+func (d *Driver) DeleteRange(r *util.Range) (int, error) {
+	if d.readOnly() {
+		return 0, ErrReadOnly
+	}
+	iterrange := &util.Range{}
+	if r != nil {
+		*iterrange = *r
+	}
+	it := d.DB.NewIterator(iterrange, nil)
+	defer it.Release()
+	w := d.newBulkWriter()
+	ok := it.First()
+	for ok {
+		//skip all keys used by driver internally
+		if isReservedKey(it.Key()) {
+			ok = it.Seek(reservedLimit)
+			continue
+		}
+		err := w.delete(it.Key())
+		if err != nil {
+			return w.written, err
+		}
+		ok = it.Next()
+	}
+	err := it.Error()
+	if err != nil {
+		return w.written, err
+	}
+	err = w.flush()
+	return w.written, err
+}
+
+//DeletePrefix delete all values with given prefix in batches.
+//Counters are not deleted,and expired values not swept yet are deleted and counted.
+//Values written after DeletePrefix started may not be deleted.
+//Return count of deleted values and any error if raised.
+//Values in batches written before error raised are deleted.
+func (d *Driver) DeletePrefix(prefix []byte) (int, error) {
+	return d.DeleteRange(util.BytesPrefix(prefix))
+}
@@ -1,16 +1,25 @@
 package leveldb
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/herb-go/herbdata"
 
 	"github.com/herb-go/herbdata/kvdb"
 	"github.com/herb-go/herbdata/kvdb/featuretestutil"
+	"github.com/syndtr/goleveldb/leveldb"
+	leveldberrors "github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 var tmpdir string
@@ -160,3 +169,1433 @@ func TestPrevOrder(t *testing.T) {
 		t.Fatal(result)
 	}
 }
+
+func TestCounter(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	d, err := (&Config{Database: db}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err = d.Stop()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	for _, v := range "aceg" {
+		err = d.Set([]byte{byte(v)}, []byte{byte(v)})
+		if err != nil {
+			panic(err)
+		}
+	}
+	for _, v := range "bdf" {
+		err = d.SetCounter([]byte{byte(v)}, 1)
+		if err != nil {
+			panic(err)
+		}
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := d.IncreaseCounter([]byte("b"), 1)
+				if err != nil {
+					panic(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	c, err := d.GetCounter([]byte("b"))
+	if c != 1001 || err != nil {
+		t.Fatal(c, err)
+	}
+	_, err = d.Get([]byte("b"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	var result = ""
+	var iter []byte
+	var data []*herbdata.KeyValue
+	for {
+		data, iter, err = d.Next(iter, 1)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range data {
+			result = result + string(v.Key)
+		}
+		if len(iter) == 0 {
+			break
+		}
+	}
+	for {
+		data, iter, err = d.Prev(iter, 1)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range data {
+			result = result + string(v.Key)
+		}
+		if len(iter) == 0 {
+			break
+		}
+	}
+	if result != "aceggeca" {
+		t.Fatal(result)
+	}
+}
+
+func TestInsertUpdate(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	d, err := (&Config{Database: db}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err = d.Stop()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	var inserted int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := d.Update([]byte("key"), []byte{byte(i)})
+			if err != nil {
+				panic(err)
+			}
+			ok, err := d.Insert([]byte("key"), []byte{byte(i)})
+			if err != nil {
+				panic(err)
+			}
+			if ok {
+				atomic.AddInt32(&inserted, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if inserted != 1 {
+		t.Fatal(inserted)
+	}
+	ok, err := d.Update([]byte("key"), []byte("value"))
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	data, err := d.Get([]byte("key"))
+	if string(data) != "value" || err != nil {
+		t.Fatal(string(data), err)
+	}
+}
+
+func TestReservedKey(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	d := &Driver{Database: db}
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err = d.Stop()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	err = d.SetCounter([]byte("c"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.SetWithTTL([]byte("k"), []byte("v"), 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range [][]byte{{1}, {1, 'c'}, {2}, append([]byte{2, 0, 0, 0, 0, 0, 0, 0, 0}, 'k'), {2, 0xff}} {
+		if err = d.Set(key, []byte("v")); err != ErrReservedKey {
+			t.Fatal(key, err)
+		}
+		if err = d.SetWithTTL(key, []byte("v"), 3600); err != ErrReservedKey {
+			t.Fatal(key, err)
+		}
+		if _, err = d.Insert(key, []byte("v")); err != ErrReservedKey {
+			t.Fatal(key, err)
+		}
+		if _, err = d.InsertWithTTL(key, []byte("v"), 3600); err != ErrReservedKey {
+			t.Fatal(key, err)
+		}
+		if _, err = d.Update(key, []byte("v")); err != ErrReservedKey {
+			t.Fatal(key, err)
+		}
+		if _, err = d.UpdateWithTTL(key, []byte("v"), 3600); err != ErrReservedKey {
+			t.Fatal(key, err)
+		}
+		if err = d.Delete(key); err != ErrReservedKey {
+			t.Fatal(key, err)
+		}
+	}
+	for _, key := range [][]byte{{0}, {0, 0xff}, {3}, {0xff}} {
+		err = d.Set(key, []byte("v"))
+		if err != nil {
+			t.Fatal(key, err)
+		}
+	}
+	v, err := d.GetCounter([]byte("c"))
+	if v != 10 || err != nil {
+		t.Fatal(v, err)
+	}
+	n, err := d.Sweep()
+	if n != 0 || err != nil {
+		t.Fatal(n, err)
+	}
+	data, err := d.Get([]byte("k"))
+	if string(data) != "v" || err != nil {
+		t.Fatal(string(data), err)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	driver, err := (&Config{Database: db, SweepIntervalInSecond: -1}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	d := driver.(*Driver)
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err = d.Stop()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	expired := time.Now().Add(-time.Second).UnixNano()
+	for _, v := range "abcde" {
+		err = d.set([]byte{byte(v)}, []byte{byte(v)}, expired)
+		if err != nil {
+			panic(err)
+		}
+	}
+	err = d.SetWithTTL([]byte("b"), []byte("b"), 3600)
+	if err != nil {
+		panic(err)
+	}
+	headervalue := append(append([]byte{}, ttlHeader...), "12345678value"...)
+	err = d.Set([]byte("d"), headervalue)
+	if err != nil {
+		panic(err)
+	}
+	_, err = d.Get([]byte("a"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	data, err := d.Get([]byte("b"))
+	if string(data) != "b" || err != nil {
+		t.Fatal(string(data), err)
+	}
+	data, err = d.Get([]byte("d"))
+	if !bytes.Equal(data, headervalue) || err != nil {
+		t.Fatal(data, err)
+	}
+	ok, err := d.Update([]byte("c"), []byte("c"))
+	if ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	ok, err = d.InsertWithTTL([]byte("c"), []byte("c"), 3600)
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	ok, err = d.UpdateWithTTL([]byte("c"), []byte("newc"), 3600)
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	var result = ""
+	var iter []byte
+	var kvs []*herbdata.KeyValue
+	for {
+		kvs, iter, err = d.Next(iter, 1)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range kvs {
+			result = result + string(v.Key)
+		}
+		if len(iter) == 0 {
+			break
+		}
+	}
+	for {
+		kvs, iter, err = d.Prev(iter, 1)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range kvs {
+			result = result + string(v.Key)
+		}
+		if len(iter) == 0 {
+			break
+		}
+	}
+	if result != "bcddcb" {
+		t.Fatal(result)
+	}
+	count, err := d.Sweep()
+	if count != 2 || err != nil {
+		t.Fatal(count, err)
+	}
+	for _, v := range "ae" {
+		_, err = d.DB.Get([]byte{byte(v)}, nil)
+		if err != leveldb.ErrNotFound {
+			t.Fatal(string(v), err)
+		}
+	}
+	data, err = d.Get([]byte("c"))
+	if string(data) != "newc" || err != nil {
+		t.Fatal(string(data), err)
+	}
+	count, err = d.Sweep()
+	if count != 0 || err != nil {
+		t.Fatal(count, err)
+	}
+}
+
+func TestSweeper(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	driver, err := (&Config{Database: db}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	d := driver.(*Driver)
+	if d.SweepInterval != DefaultSweepInterval {
+		t.Fatal(d.SweepInterval)
+	}
+	d.SweepInterval = 10 * time.Millisecond
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	err = d.set([]byte("key"), []byte("value"), time.Now().Add(-time.Second).UnixNano())
+	if err != nil {
+		panic(err)
+	}
+	for i := 0; ; i++ {
+		_, err = d.DB.Get([]byte("key"), nil)
+		if err == leveldb.ErrNotFound {
+			break
+		}
+		if i > 100 {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	err = d.Stop()
+	if err != nil {
+		panic(err)
+	}
+	err = d.Stop()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestSweepIndexWithoutTTL(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	d := &Driver{Database: db}
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err = d.Stop()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	err = d.Set([]byte("plain"), []byte("value"))
+	if err != nil {
+		panic(err)
+	}
+	err = d.SetWithTTL([]byte("ttl"), []byte("value"), 3600)
+	if err != nil {
+		panic(err)
+	}
+	//index keys written by other programs
+	past := time.Now().Add(-time.Second).UnixNano()
+	for _, k := range [][]byte{getExpiryKey(0, []byte("plain")), getExpiryKey(past, []byte("plain")), getExpiryKey(past, []byte("ttl"))} {
+		err = d.DB.Put(k, nil, nil)
+		if err != nil {
+			panic(err)
+		}
+	}
+	count, err := d.Sweep()
+	if count != 0 || err != nil {
+		t.Fatal(count, err)
+	}
+	for _, k := range []string{"plain", "ttl"} {
+		data, err := d.Get([]byte(k))
+		if string(data) != "value" || err != nil {
+			t.Fatal(k, string(data), err)
+		}
+	}
+	_, err = d.DB.Get(getExpiryKey(past, []byte("plain")), nil)
+	if err != leveldb.ErrNotFound {
+		t.Fatal(err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	c := &Config{
+		Database:               db,
+		BlockCacheCapacity:     "16MB",
+		WriteBuffer:            "512kb",
+		Compression:            "none",
+		BloomFilterBits:        10,
+		OpenFilesCacheCapacity: 100,
+	}
+	driver, err := c.CreateDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := driver.(*Driver)
+	o := d.Options
+	if o.BlockCacheCapacity != 16*1024*1024 || o.WriteBuffer != 512*1024 || o.Compression != opt.NoCompression || o.Filter == nil || o.OpenFilesCacheCapacity != 100 {
+		t.Fatal(o)
+	}
+	err = d.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Set([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err = (&Config{Database: db}).Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.BlockCacheCapacity != 0 || o.WriteBuffer != 0 || o.Compression != opt.DefaultCompression || o.Filter != nil || o.OpenFilesCacheCapacity != 0 {
+		t.Fatal(o)
+	}
+	for _, v := range []*Config{
+		{Database: db, BlockCacheCapacity: "16TB"},
+		{Database: db, WriteBuffer: "-1MB"},
+		{Database: db, WriteBuffer: "MB"},
+		{Database: db, Compression: "zstd"},
+		{Database: db, BloomFilterBits: -1},
+		{Database: db, OpenFilesCacheCapacity: -1},
+	} {
+		_, err = v.CreateDriver()
+		if err == nil {
+			t.Fatal(v)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for k, v := range map[string]int{
+		"":       0,
+		"1024":   1024,
+		"10B":    10,
+		"2K":     2048,
+		"2 kb":   2048,
+		"64MB":   64 * 1024 * 1024,
+		"1G":     1024 * 1024 * 1024,
+		" 1GB  ": 1024 * 1024 * 1024,
+	} {
+		size, err := parseSize(k)
+		if size != v || err != nil {
+			t.Fatal(k, size, err)
+		}
+	}
+	for _, v := range []string{"1.5MB", "-1", "4GB", "1TB"} {
+		_, err := parseSize(v)
+		if err != ErrInvalidSize {
+			t.Fatal(v, err)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	_, err = (&Config{Database: db, ReadOnly: true, Recover: true}).CreateDriver()
+	if err != ErrRecoverReadOnly {
+		t.Fatal(err)
+	}
+	d, err := (&Config{Database: db}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	err = d.Set([]byte("key"), []byte("value"))
+	if err != nil {
+		panic(err)
+	}
+	//writer keeps database open while read-only drivers start
+	defer func() {
+		err = d.Stop()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	drivers := []kvdb.Driver{}
+	for i := 0; i < 2; i++ {
+		rd, err := (&Config{Database: db, ReadOnly: true}).CreateDriver()
+		if err != nil {
+			panic(err)
+		}
+		err = rd.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		drivers = append(drivers, rd)
+	}
+	err = d.Set([]byte("newkey"), []byte("value"))
+	if err != nil {
+		panic(err)
+	}
+	for _, d := range drivers {
+		data, err := d.Get([]byte("key"))
+		if string(data) != "value" || err != nil {
+			t.Fatal(string(data), err)
+		}
+		_, err = d.Get([]byte("newkey"))
+		if err != herbdata.ErrNotFound {
+			t.Fatal(err)
+		}
+		checkpoint := d.(*Driver).checkpoint
+		if checkpoint == "" || checkpoint == db {
+			t.Fatal(checkpoint)
+		}
+		if d.Set([]byte("key"), []byte("value")) != ErrReadOnly ||
+			d.SetWithTTL([]byte("key"), []byte("value"), 10) != ErrReadOnly ||
+			d.Delete([]byte("key")) != ErrReadOnly ||
+			d.SetCounter([]byte("key"), 1) != ErrReadOnly ||
+			d.DeleteCounter([]byte("key")) != ErrReadOnly {
+			t.Fatal("write allowed")
+		}
+		_, err = d.Insert([]byte("newkey"), []byte("value"))
+		if err != ErrReadOnly {
+			t.Fatal(err)
+		}
+		_, err = d.Update([]byte("key"), []byte("value"))
+		if err != ErrReadOnly {
+			t.Fatal(err)
+		}
+		_, err = d.IncreaseCounter([]byte("key"), 1)
+		if err != ErrReadOnly {
+			t.Fatal(err)
+		}
+		_, err = d.(*Driver).Sweep()
+		if err != ErrReadOnly {
+			t.Fatal(err)
+		}
+		err = d.Stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = os.Stat(checkpoint)
+		if !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadOnlyWhileWriting(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	//small write buffer makes writer flush tables and compact while checkpoints created
+	d := &Driver{Database: db, Options: &opt.Options{WriteBuffer: 16 * 1024}}
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err = d.Stop()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	value := bytes.Repeat([]byte("v"), 100)
+	for i := 0; i < 1000; i++ {
+		err = d.Set([]byte(fmt.Sprintf("key%05d", i)), value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	stopped := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1000; ; i++ {
+			select {
+			case <-stopped:
+				return
+			default:
+			}
+			err := d.Set([]byte(fmt.Sprintf("key%05d", i%5000)), value)
+			if err != nil {
+				panic(err)
+			}
+		}
+	}()
+	defer func() {
+		close(stopped)
+		<-done
+	}()
+	for i := 0; i < 10; i++ {
+		rd := &Driver{Database: db, Options: &opt.Options{ReadOnly: true}}
+		err = rd.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		var iter []byte
+		for {
+			var kvs []*herbdata.KeyValue
+			kvs, iter, err = rd.Next(iter, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range kvs {
+				if !bytes.Equal(v.Value, value) {
+					t.Fatal(string(v.Key), v.Value)
+				}
+			}
+			count += len(kvs)
+			if len(iter) == 0 {
+				break
+			}
+		}
+		if count < 1000 {
+			t.Fatal(count)
+		}
+		err = rd.Stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	d, err := (&Config{Database: db}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	err = d.Set([]byte("key"), []byte("value"))
+	if err != nil {
+		panic(err)
+	}
+	err = d.(*Driver).DB.CompactRange(util.Range{})
+	if err != nil {
+		panic(err)
+	}
+	err = d.Stop()
+	if err != nil {
+		panic(err)
+	}
+	manifests, err := filepath.Glob(filepath.Join(db, "MANIFEST-*"))
+	if err != nil || len(manifests) == 0 {
+		t.Fatal(manifests, err)
+	}
+	for _, v := range manifests {
+		err = ioutil.WriteFile(v, []byte(strings.Repeat("corrupted", 100)), 0644)
+		if err != nil {
+			panic(err)
+		}
+	}
+	d, err = (&Config{Database: db}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	err = d.Start()
+	if !leveldberrors.IsCorrupted(err) {
+		t.Fatal(err)
+	}
+	d, err = (&Config{Database: db, Recover: true}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	var recovered error
+	d.SetErrorHandler(func(err error) {
+		recovered = err
+	})
+	err = d.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Stop()
+	e, ok := recovered.(*RecoveredError)
+	if !ok || e.Database != db || !leveldberrors.IsCorrupted(e.Err) {
+		t.Fatal(recovered)
+	}
+	data, err := d.Get([]byte("key"))
+	if string(data) != "value" || err != nil {
+		t.Fatal(string(data), err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	driver, err := (&Config{Database: db}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	d := driver.(*Driver)
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer d.Stop()
+	err = d.Set([]byte("deleted"), []byte("value"))
+	if err != nil {
+		panic(err)
+	}
+	headervalue := append(append([]byte{}, ttlHeader...), "12345678value"...)
+	b := d.NewBatch()
+	b.Set([]byte("entity"), []byte("value"))
+	b.Set([]byte("index"), headervalue)
+	b.Delete([]byte("deleted"))
+	if b.Len() != 3 {
+		t.Fatal(b.Len())
+	}
+	_, err = d.Get([]byte("entity"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	err = b.Commit(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := d.Get([]byte("entity"))
+	if string(data) != "value" || err != nil {
+		t.Fatal(string(data), err)
+	}
+	data, err = d.Get([]byte("index"))
+	if !bytes.Equal(data, headervalue) || err != nil {
+		t.Fatal(data, err)
+	}
+	_, err = d.Get([]byte("deleted"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	b.Reset()
+	if b.Len() != 0 {
+		t.Fatal(b.Len())
+	}
+	b.Delete([]byte("entity"))
+	err = b.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.Get([]byte("entity"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	err = d.SetCounter([]byte("c"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	b.Set([]byte("entity"), []byte("value"))
+	b.Set([]byte{1, 'c'}, []byte("value"))
+	b.Delete([]byte{2})
+	if b.Len() != 1 {
+		t.Fatal(b.Len())
+	}
+	err = b.Commit(false)
+	if err != ErrReservedKey {
+		t.Fatal(err)
+	}
+	_, err = d.Get([]byte("entity"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	v, err := d.GetCounter([]byte("c"))
+	if v != 10 || err != nil {
+		t.Fatal(v, err)
+	}
+	b.Reset()
+	b.Set([]byte("entity"), []byte("value"))
+	err = b.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	driver, err := (&Config{Database: db}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	d := driver.(*Driver)
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer d.Stop()
+	for _, v := range "abc" {
+		err = d.Set([]byte{byte(v)}, []byte{byte(v)})
+		if err != nil {
+			panic(err)
+		}
+	}
+	s, err := d.NewSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Set([]byte("a"), []byte("new"))
+	if err != nil {
+		panic(err)
+	}
+	err = d.Delete([]byte("b"))
+	if err != nil {
+		panic(err)
+	}
+	err = d.Set([]byte("d"), []byte("d"))
+	if err != nil {
+		panic(err)
+	}
+	data, err := s.Get([]byte("a"))
+	if string(data) != "a" || err != nil {
+		t.Fatal(string(data), err)
+	}
+	_, err = s.Get([]byte("d"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	var result = ""
+	var iter []byte
+	var kvs []*herbdata.KeyValue
+	for {
+		kvs, iter, err = s.Next(iter, 1)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range kvs {
+			result = result + string(v.Key) + string(v.Value)
+		}
+		if len(iter) == 0 {
+			break
+		}
+	}
+	for {
+		kvs, iter, err = s.Prev(iter, 2)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range kvs {
+			result = result + string(v.Key)
+		}
+		if len(iter) == 0 {
+			break
+		}
+	}
+	if result != "aabbcccba" {
+		t.Fatal(result)
+	}
+	s.Release()
+	_, err = s.Get([]byte("a"))
+	if err != leveldb.ErrSnapshotReleased {
+		t.Fatal(err)
+	}
+}
+
+func TestRange(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	driver, err := (&Config{Database: db}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	d := driver.(*Driver)
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer d.Stop()
+	for _, v := range []string{"a", "ab", "abc", "abd", "ac", "b", "ba"} {
+		err = d.Set([]byte(v), []byte(v))
+		if err != nil {
+			panic(err)
+		}
+	}
+	for _, v := range []string{"a", "z"} {
+		err = d.SetCounter([]byte(v), 1)
+		if err != nil {
+			panic(err)
+		}
+	}
+	walk := func(f func(iter []byte, limit int) ([]*herbdata.KeyValue, []byte, error), limit int) string {
+		var result []string
+		var iter []byte
+		for {
+			kvs, newiter, err := f(iter, limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) > limit {
+				t.Fatal(len(kvs))
+			}
+			for _, v := range kvs {
+				if !bytes.Equal(v.Key, v.Value) {
+					t.Fatal(v.Key, v.Value)
+				}
+				result = append(result, string(v.Key))
+			}
+			if len(newiter) == 0 {
+				break
+			}
+			iter = newiter
+		}
+		return strings.Join(result, ",")
+	}
+	for _, limit := range []int{1, 2, 10} {
+		if r := walk(func(iter []byte, limit int) ([]*herbdata.KeyValue, []byte, error) {
+			return d.NextWithPrefix([]byte("ab"), iter, limit)
+		}, limit); r != "ab,abc,abd" {
+			t.Fatal(r)
+		}
+		if r := walk(func(iter []byte, limit int) ([]*herbdata.KeyValue, []byte, error) {
+			return d.PrevWithPrefix([]byte("ab"), iter, limit)
+		}, limit); r != "abd,abc,ab" {
+			t.Fatal(r)
+		}
+		if r := walk(func(iter []byte, limit int) ([]*herbdata.KeyValue, []byte, error) {
+			return d.NextInRange(&util.Range{Start: []byte("abc"), Limit: []byte("b")}, iter, limit)
+		}, limit); r != "abc,abd,ac" {
+			t.Fatal(r)
+		}
+		if r := walk(func(iter []byte, limit int) ([]*herbdata.KeyValue, []byte, error) {
+			return d.PrevInRange(&util.Range{Start: []byte("abc"), Limit: []byte("b")}, iter, limit)
+		}, limit); r != "ac,abd,abc" {
+			t.Fatal(r)
+		}
+		if r := walk(func(iter []byte, limit int) ([]*herbdata.KeyValue, []byte, error) {
+			return d.NextInRange(&util.Range{Start: []byte{1}, Limit: []byte("ab")}, iter, limit)
+		}, limit); r != "a" {
+			t.Fatal(r)
+		}
+		if r := walk(func(iter []byte, limit int) ([]*herbdata.KeyValue, []byte, error) {
+			return d.PrevInRange(&util.Range{Start: []byte{1, 'b'}, Limit: []byte("ab")}, iter, limit)
+		}, limit); r != "a" {
+			t.Fatal(r)
+		}
+		if r := walk(func(iter []byte, limit int) ([]*herbdata.KeyValue, []byte, error) {
+			return d.PrevInRange(&util.Range{Start: []byte{1, 'b'}, Limit: []byte{2}}, iter, limit)
+		}, limit); r != "" {
+			t.Fatal(r)
+		}
+		if r := walk(func(iter []byte, limit int) ([]*herbdata.KeyValue, []byte, error) {
+			return d.NextInRange(&util.Range{Start: []byte("b")}, iter, limit)
+		}, limit); r != "b,ba" {
+			t.Fatal(r)
+		}
+		if r := walk(func(iter []byte, limit int) ([]*herbdata.KeyValue, []byte, error) {
+			return d.PrevInRange(&util.Range{Limit: []byte("ab")}, iter, limit)
+		}, limit); r != "a" {
+			t.Fatal(r)
+		}
+	}
+	kvs, iter, err := d.NextWithPrefix([]byte("ab"), []byte("b"), 10)
+	if len(kvs) != 0 || len(iter) != 0 || err != nil {
+		t.Fatal(kvs, iter, err)
+	}
+	kvs, iter, err = d.PrevWithPrefix([]byte("ab"), []byte("b"), 10)
+	if len(kvs) != 3 || len(iter) != 0 || err != nil {
+		t.Fatal(kvs, iter, err)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	driver, err := (&Config{Database: db}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	d := driver.(*Driver)
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer d.Stop()
+	value := bytes.Repeat([]byte("v"), 1000)
+	for i := 0; i < 1000; i++ {
+		err = d.Set([]byte(fmt.Sprintf("key%04d", i)), value)
+		if err != nil {
+			panic(err)
+		}
+	}
+	err = d.Compact(&util.Range{Start: []byte("key0000"), Limit: []byte("key0500")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Compact(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := d.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables int
+	for _, v := range stats.LevelTablesCounts {
+		tables = tables + v
+	}
+	if tables == 0 {
+		t.Fatal(stats.LevelTablesCounts)
+	}
+	p, err := d.Property("leveldb.stats")
+	if p == "" || err != nil {
+		t.Fatal(p, err)
+	}
+	_, err = d.Property("leveldb.unknown")
+	if err == nil {
+		t.Fatal(err)
+	}
+	total, err := d.SizeOf(nil)
+	if total <= 0 || err != nil {
+		t.Fatal(total, err)
+	}
+	if total != stats.LevelSizes.Sum() {
+		t.Fatal(total, stats.LevelSizes.Sum())
+	}
+	head, err := d.SizeOf(&util.Range{Limit: []byte("key0500")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail, err := d.SizeOf(&util.Range{Start: []byte("key0500")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head < 0 || tail < 0 || head+tail != total {
+		t.Fatal(head, tail, total)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	newDriver := func() *Driver {
+		db, err := ioutil.TempDir(tmpdir, "")
+		if err != nil {
+			panic(err)
+		}
+		tmpdb = append(tmpdb, db)
+		driver, err := (&Config{Database: db}).CreateDriver()
+		if err != nil {
+			panic(err)
+		}
+		err = driver.Start()
+		if err != nil {
+			panic(err)
+		}
+		return driver.(*Driver)
+	}
+	d := newDriver()
+	defer d.Stop()
+	for i := 0; i < 2500; i++ {
+		err = d.Set([]byte(fmt.Sprintf("key%04d", i)), []byte(fmt.Sprintf("value%04d", i)))
+		if err != nil {
+			panic(err)
+		}
+	}
+	err = d.Set([]byte{}, []byte{})
+	if err != nil {
+		panic(err)
+	}
+	err = d.SetWithTTL([]byte("ttl"), []byte("value"), 3600)
+	if err != nil {
+		panic(err)
+	}
+	err = d.SetCounter([]byte("counter"), 5)
+	if err != nil {
+		panic(err)
+	}
+	check := func(r *Driver) {
+		for i := 0; i < 2500; i++ {
+			data, err := r.Get([]byte(fmt.Sprintf("key%04d", i)))
+			if string(data) != fmt.Sprintf("value%04d", i) || err != nil {
+				t.Fatal(string(data), err)
+			}
+		}
+		data, err := r.Get([]byte("ttl"))
+		if string(data) != "value" || err != nil {
+			t.Fatal(string(data), err)
+		}
+		c, err := r.GetCounter([]byte("counter"))
+		if c != 5 || err != nil {
+			t.Fatal(c, err)
+		}
+		_, err = r.Get([]byte{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = r.Get([]byte("after"))
+		if err != herbdata.ErrNotFound {
+			t.Fatal(err)
+		}
+	}
+	buf := bytes.NewBuffer(nil)
+	err = d.Backup(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, dir)
+	dir = filepath.Join(dir, "backup")
+	err = d.BackupToDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.BackupToDir(dir)
+	if err == nil {
+		t.Fatal(err)
+	}
+	err = d.Set([]byte("after"), []byte("value"))
+	if err != nil {
+		panic(err)
+	}
+	data := buf.Bytes()
+	r := newDriver()
+	defer r.Stop()
+	err = r.Restore(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(r)
+	r = newDriver()
+	defer r.Stop()
+	err = r.RestoreFromDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(r)
+	r = newDriver()
+	defer r.Stop()
+	for _, v := range [][]byte{
+		nil,
+		data[:3],
+		data[:len(data)-1],
+		append(append([]byte{}, data[:len(data)-4]...), 0, 0, 0, 0),
+		append([]byte{'x'}, data[1:]...),
+	} {
+		err = r.Restore(bytes.NewReader(v))
+		if err != ErrInvalidBackup {
+			t.Fatal(err)
+		}
+	}
+	//nothing written by invalid backups
+	it := r.DB.NewIterator(nil, nil)
+	defer it.Release()
+	if it.Next() {
+		t.Fatal(it.Key())
+	}
+}
+
+func TestKeys(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	driver, err := (&Config{Database: db}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	d := driver.(*Driver)
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer d.Stop()
+	for _, v := range "abcde" {
+		err = d.Set([]byte{byte(v)}, []byte{byte(v)})
+		if err != nil {
+			panic(err)
+		}
+	}
+	err = d.set([]byte("c"), []byte("c"), time.Now().Add(-time.Second).UnixNano())
+	if err != nil {
+		panic(err)
+	}
+	err = d.SetCounter([]byte("a"), 1)
+	if err != nil {
+		panic(err)
+	}
+	_, _, err = d.NextKeys(nil, 0)
+	if err != kvdb.ErrUnsupportedNextLimit {
+		t.Fatal(err)
+	}
+	var result = ""
+	var iter []byte
+	var keys [][]byte
+	for {
+		keys, iter, err = d.NextKeys(iter, 2)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range keys {
+			result = result + string(v)
+		}
+		if len(iter) == 0 {
+			break
+		}
+	}
+	for {
+		keys, iter, err = d.PrevKeys(iter, 2)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range keys {
+			result = result + string(v)
+		}
+		if len(iter) == 0 {
+			break
+		}
+	}
+	if result != "abdeedba" {
+		t.Fatal(result)
+	}
+}
+
+func TestDeleteRange(t *testing.T) {
+	var err error
+	tmpdir, err = ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer Clean()
+	db, err := ioutil.TempDir(tmpdir, "")
+	if err != nil {
+		panic(err)
+	}
+	tmpdb = append(tmpdb, db)
+	driver, err := (&Config{Database: db}).CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	d := driver.(*Driver)
+	err = d.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer d.Stop()
+	for i := 0; i < 2500; i++ {
+		for _, prefix := range []string{"a", "b", "c"} {
+			err = d.Set([]byte(fmt.Sprintf("%s%04d", prefix, i)), []byte("value"))
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+	err = d.SetCounter([]byte("b0001"), 1)
+	if err != nil {
+		panic(err)
+	}
+	count, err := d.DeletePrefix([]byte("b"))
+	if count != 2500 || err != nil {
+		t.Fatal(count, err)
+	}
+	_, err = d.Get([]byte("b0001"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	c, err := d.GetCounter([]byte("b0001"))
+	if c != 1 || err != nil {
+		t.Fatal(c, err)
+	}
+	count, err = d.DeleteRange(&util.Range{Start: []byte("a1000"), Limit: []byte("c1000")})
+	if count != 1500+1000 || err != nil {
+		t.Fatal(count, err)
+	}
+	count, err = d.DeleteRange(nil)
+	if count != 1000+1500 || err != nil {
+		t.Fatal(count, err)
+	}
+	kvs, _, err := d.Next(nil, 10)
+	if len(kvs) != 0 || err != nil {
+		t.Fatal(kvs, err)
+	}
+	c, err = d.GetCounter([]byte("b0001"))
+	if c != 1 || err != nil {
+		t.Fatal(c, err)
+	}
+}
@@ -3,14 +3,26 @@ package leveldb
 import (
 	"bytes"
 	"errors"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/herb-go/herbdata"
 	"github.com/herb-go/herbdata/kvdb"
 	"github.com/syndtr/goleveldb/leveldb"
+	leveldberrors "github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 const Features = kvdb.FeatureStore |
+	kvdb.FeatureCounter |
+	kvdb.FeatureInsert |
+	kvdb.FeatureUpdate |
+	kvdb.FeatureTTLStore |
+	kvdb.FeatureTTLInsert |
+	kvdb.FeatureTTLUpdate |
 	kvdb.FeatureNext |
 	kvdb.FeaturePrev |
 	kvdb.FeatureEmbedded
@@ -25,21 +37,137 @@ func convertError(err error) error {
 	return err
 }
 
+//ErrReadOnly error raised if writing database opened in read-only mode.
+var ErrReadOnly = leveldb.ErrReadOnly
+
+//ErrRecoverReadOnly error raised if both read-only mode and recovery are enabled.
+var ErrRecoverReadOnly = errors.New("leveldb: read-only database can not be recovered")
+
+//RecoveredError error reported to error handler after corrupted database recovered with RecoverFile.
+type RecoveredError struct {
+	//Database path of recovered database.
+	Database string
+	//Err corruption error returned when opening database.
+	Err error
+}
+
+//Error return error message
+func (e *RecoveredError) Error() string {
+	return "leveldb: database " + e.Database + " recovered from corruption: " + e.Err.Error()
+}
+
+//Unwrap return corruption error
+func (e *RecoveredError) Unwrap() error {
+	return e.Err
+}
+
+//ErrReservedKey error raised if writing data key which starts with byte 1 or 2.
+//Keys starting with these bytes are reserved for counters and expiry index.
+var ErrReservedKey = errors.New("leveldb: keys starting with byte 1 or 2 are reserved")
+
+//reservedStart first key used by driver internally,including counters and expiry index.
+//Data keys should not start with byte 1 or 2.
+var reservedStart = counterPrefix
+
+//reservedLimit first key after all keys used by driver internally.
+var reservedLimit = []byte{3}
+
+func isReservedKey(key []byte) bool {
+	return bytes.Compare(key, reservedStart) >= 0 && bytes.Compare(key, reservedLimit) < 0
+}
+
+//Driver leveldb driver.
+//Counters and expiry index are stored in same keyspace with data,
+//so data keys starting with byte 1 or 2 are reserved and can not be written,
+//ErrReservedKey will be returned instead.
 type Driver struct {
 	kvdb.Nop
 	Database string
 	DB       *leveldb.DB
+	//Options options used to open database.
+	//Default options will be used if nil.
+	Options *opt.Options
+	//Recover recover database with RecoverFile if database is corrupted,
+	//and report RecoveredError to error handler.
+	Recover bool
+	//SweepInterval interval to delete expired values in background.
+	//Expired values will only be deleted by Sweep if SweepInterval is not positive.
+	SweepInterval time.Duration
+	locks         stripedLock
+	checkpoint    string
+	errhandler    func(error)
+	stopped       chan struct{}
+	wg            sync.WaitGroup
+}
+
+//SetErrorHandler set error handler used to report errors raised in background and database recovery.
+func (d *Driver) SetErrorHandler(f func(error)) {
+	d.errhandler = f
+}
+
+func (d *Driver) handleError(err error) {
+	if d.errhandler != nil {
+		d.errhandler(err)
+	}
 }
 
 //Start start database
+//Database will be opened from a checkpoint in temporary directory in read-only mode,
+//so it can be opened while owned by other process.
 func (d *Driver) Start() error {
 	var err error
-	d.DB, err = leveldb.OpenFile(d.Database, nil)
-	return err
+	path := d.Database
+	options := d.Options
+	if d.readOnly() {
+		d.checkpoint, err = createCheckpoint(d.Database)
+		if err != nil {
+			return err
+		}
+		path = d.checkpoint
+		//checkpoint is owned by driver,and goleveldb can not replay more than one journal in read-only mode,
+		//so checkpoint is opened in read-write mode while driver still rejects all writes.
+		//Files created by checkpoint database are numbered after all linked tables,
+		//so tables shared with database owner are never written.
+		o := *d.Options
+		o.ReadOnly = false
+		options = &o
+	}
+	d.DB, err = leveldb.OpenFile(path, options)
+	if err != nil {
+		if !d.Recover || !leveldberrors.IsCorrupted(err) {
+			d.removeCheckpoint()
+			return err
+		}
+		var rerr error
+		d.DB, rerr = leveldb.RecoverFile(path, options)
+		if rerr != nil {
+			d.removeCheckpoint()
+			return rerr
+		}
+		d.handleError(&RecoveredError{Database: d.Database, Err: err})
+	}
+	if !d.readOnly() {
+		d.startSweeper()
+	}
+	return nil
+}
+
+func (d *Driver) readOnly() bool {
+	return d.Options != nil && d.Options.ReadOnly
+}
+
+func (d *Driver) removeCheckpoint() {
+	if d.checkpoint != "" {
+		os.RemoveAll(d.checkpoint)
+		d.checkpoint = ""
+	}
 }
 
 //Stop stop database
+//Checkpoint created in read-only mode will be removed.
 func (d *Driver) Stop() error {
+	d.stopSweeper()
+	defer d.removeCheckpoint()
 	if d.DB != nil {
 		err := d.DB.Close()
 		if err == leveldb.ErrClosed {
@@ -51,21 +179,60 @@ func (d *Driver) Stop() error {
 }
 
 //Set set value by given key
+//ErrReservedKey will be returned if key starts with byte 1 or 2.
 func (d *Driver) Set(key []byte, value []byte) error {
-	return d.DB.Put(key, value, nil)
+	return d.set(key, value, 0)
+}
+
+//Insert insert value with given key.
+//Insert will fail if data with given key exists.
+//Return if operation success and any error if raised
+func (d *Driver) Insert(key []byte, value []byte) (bool, error) {
+	return d.insert(key, value, 0)
+}
+
+//Update update value with given key.
+//Update will fail if data with given key does nto exist.
+//Return if operation success and any error if raised
+func (d *Driver) Update(key []byte, value []byte) (bool, error) {
+	return d.update(key, value, 0)
+}
+
+//reader database reader,implemented by both leveldb.DB and leveldb.Snapshot.
+type reader interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
 }
 
 //Get get value by given key
 func (d *Driver) Get(key []byte) ([]byte, error) {
-	bs, err := d.DB.Get(key, nil)
+	return get(d.DB, key)
+}
+
+func get(r reader, key []byte) ([]byte, error) {
+	bs, err := r.Get(key, nil)
 	if err != nil {
 		return nil, convertError(err)
 	}
-	return bs, nil
+	value, expiredAt := decodeValue(bs)
+	if isExpired(expiredAt, time.Now().UnixNano()) {
+		return nil, herbdata.ErrNotFound
+	}
+	return value, nil
 }
 
 //Delete delete value by given key
+//ErrReservedKey will be returned if key starts with byte 1 or 2.
 func (d *Driver) Delete(key []byte) error {
+	if d.readOnly() {
+		return ErrReadOnly
+	}
+	if isReservedKey(key) {
+		return ErrReservedKey
+	}
+	l := d.locks.get(key)
+	l.Lock()
+	defer l.Unlock()
 	err := d.DB.Delete(key, nil)
 	if err == leveldb.ErrNotFound {
 		return nil
@@ -77,99 +244,117 @@ func (d *Driver) Delete(key []byte) error {
 //Empty iter (nil or 0 length []byte) will start a new search
 //Return keyvalue ,newiter and any error if raised.
 //Empty iter (nil or 0 length []byte) will be returned if no more keys
+//Counters and expired values are not returned.
 func (d *Driver) Next(iter []byte, limit int) (result []*herbdata.KeyValue, newiter []byte, err error) {
-	if limit <= 0 {
-		return nil, nil, kvdb.ErrUnsupportedNextLimit
-	}
-	iterrange := &util.Range{}
-	if len(iter) > 0 {
-		iterrange.Start = iter
-	}
-	it := d.DB.NewIterator(iterrange, nil)
+	return next(d.DB, nil, iter, limit)
+}
 
-	defer it.Release()
-	var found bool
-	if len(iter) == 0 {
-		found = true
-	}
-	if it.First() {
-		for {
-			if !found {
-				if bytes.Compare(iter, it.Key()) >= 0 {
-					if !it.Next() {
-						break
-					}
-					continue
-				}
-				found = true
-			}
-			kv := &herbdata.KeyValue{
-				Key:   it.Key(),
-				Value: it.Value(),
-			}
-			result = append(result, kv.Clone())
-			if limit >= 0 && len(result) >= limit {
-				return result, it.Key(), nil
-			}
-			if !it.Next() {
-				break
-			}
+//next return keys in given range after iter not more than given limit.
+//All keys will be walked if range is nil.
+func next(r reader, slice *util.Range, iter []byte, limit int) (result []*herbdata.KeyValue, newiter []byte, err error) {
+	newiter, err = scan(r, slice, iter, limit, false, func(key []byte, value []byte) {
+		kv := &herbdata.KeyValue{
+			Key:   key,
+			Value: value,
 		}
-	}
-	err = it.Error()
+		result = append(result, kv.Clone())
+	})
 	if err != nil {
 		return nil, nil, err
 	}
-	return result, nil, nil
+	return result, newiter, nil
 }
 
 //Prev return keys before iter not more than given limit
 //Empty iter (nil or 0 length []byte) will start a new search
 //Return keys ,newiter and any error if raised.
 //Empty iter (nil or 0 length []byte) will be returned if no more keys
+//Counters and expired values are not returned.
 func (d *Driver) Prev(iter []byte, limit int) (result []*herbdata.KeyValue, newiter []byte, err error) {
+	return prev(d.DB, nil, iter, limit)
+}
+
+//prev return keys in given range before iter not more than given limit.
+//All keys will be walked if range is nil.
+func prev(r reader, slice *util.Range, iter []byte, limit int) (result []*herbdata.KeyValue, newiter []byte, err error) {
+	newiter, err = scan(r, slice, iter, limit, true, func(key []byte, value []byte) {
+		kv := &herbdata.KeyValue{
+			Key:   key,
+			Value: value,
+		}
+		result = append(result, kv.Clone())
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, newiter, nil
+}
+
+//scan walk unexpired values in given range after iter,or before iter if reverse is true.
+//Given function will be called with key and value not more than limit times,
+//key and value are only valid until function returns.
+//All keys will be walked if range is nil.
+//Return newiter and any error if raised.
+func scan(r reader, slice *util.Range, iter []byte, limit int, reverse bool, f func(key []byte, value []byte)) (newiter []byte, err error) {
 	if limit <= 0 {
-		return nil, nil, kvdb.ErrUnsupportedNextLimit
+		return nil, kvdb.ErrUnsupportedNextLimit
 	}
 	iterrange := &util.Range{}
-	if len(iter) > 0 {
-		iterrange.Limit = iter
+	if slice != nil {
+		*iterrange = *slice
 	}
-	it := d.DB.NewIterator(iterrange, nil)
-	defer it.Release()
-	var found bool
-	if len(iter) == 0 {
-		found = true
-	}
-	if it.Last() {
-		for {
-			if !found {
-				if bytes.Compare(iter, it.Key()) <= 0 {
-					if !it.Prev() {
-						break
-					}
-					continue
-				}
-				found = true
+	if len(iter) > 0 {
+		if reverse {
+			//range limit is exclusive,so iter itself will not be returned
+			if iterrange.Limit == nil || bytes.Compare(iter, iterrange.Limit) < 0 {
+				iterrange.Limit = iter
 			}
-			kv := &herbdata.KeyValue{
-				Key:   it.Key(),
-				Value: it.Value(),
+		} else {
+			//smallest key after iter
+			start := append(append([]byte{}, iter...), 0)
+			if bytes.Compare(start, iterrange.Start) > 0 {
+				iterrange.Start = start
 			}
-			result = append(result, kv.Clone())
-			if limit >= 0 && len(result) >= limit {
-				return result, it.Key(), nil
+		}
+	}
+	it := r.NewIterator(iterrange, nil)
+	defer it.Release()
+	now := time.Now().UnixNano()
+	var count int
+	ok := it.First()
+	if reverse {
+		ok = it.Last()
+	}
+	for ok {
+		//skip all keys used by driver internally
+		if isReservedKey(it.Key()) {
+			if reverse {
+				it.Seek(reservedStart)
+				ok = it.Prev()
+			} else {
+				ok = it.Seek(reservedLimit)
 			}
-			if !it.Prev() {
-				break
+			continue
+		}
+		value, expiredAt := decodeValue(it.Value())
+		if !isExpired(expiredAt, now) {
+			f(it.Key(), value)
+			count++
+			if count >= limit {
+				return append([]byte{}, it.Key()...), nil
 			}
 		}
+		if reverse {
+			ok = it.Prev()
+		} else {
+			ok = it.Next()
+		}
 	}
 	err = it.Error()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	return result, nil, nil
+	return nil, nil
 }
 
 //Features return supported features
@@ -179,10 +364,51 @@ func (d *Driver) Features() kvdb.Feature {
 
 type Config struct {
 	Database string
+	//SweepIntervalInSecond interval in second to delete expired values in background.
+	//DefaultSweepInterval will be used if 0,and background sweeping is disabled if negative.
+	SweepIntervalInSecond int64
+	//BlockCacheCapacity capacity of sorted table block cache,like "64MB".
+	//goleveldb default value 8MB will be used if empty.
+	BlockCacheCapacity string
+	//WriteBuffer size of memtable,like "16MB".
+	//goleveldb default value 4MB will be used if empty.
+	WriteBuffer string
+	//Compression compression of sorted table blocks,"snappy" or "none".
+	//Snappy will be used if empty.
+	Compression string
+	//BloomFilterBits bits per key of bloom filter used to reduce disk reads for missing keys.
+	//Bloom filter is disabled if 0.
+	BloomFilterBits int
+	//OpenFilesCacheCapacity capacity of open files cache.
+	//goleveldb default value 500 will be used if 0.
+	OpenFilesCacheCapacity int
+	//ReadOnly open database in read-only mode,all writes will fail with ErrReadOnly.
+	//Database is opened from a checkpoint created in temporary directory when driver starts,
+	//so it can be opened while owned and written by other process,
+	//but writes after driver started are not visible.
+	//Tables referred by current manifest are hard linked into checkpoint if possible,or copied otherwise.
+	ReadOnly bool
+	//Recover recover database with RecoverFile if it is corrupted when opening,
+	//and report RecoveredError to error handler.
+	//Values in corrupted tables may be lost.
+	Recover bool
 }
 
 func (c *Config) ApplyTo(d *Driver) error {
+	options, err := c.Options()
+	if err != nil {
+		return err
+	}
+	if c.ReadOnly && c.Recover {
+		return ErrRecoverReadOnly
+	}
 	d.Database = c.Database
+	d.Options = options
+	d.Recover = c.Recover
+	d.SweepInterval = DefaultSweepInterval
+	if c.SweepIntervalInSecond != 0 {
+		d.SweepInterval = time.Duration(c.SweepIntervalInSecond) * time.Second
+	}
 	return nil
 }
 func (c *Config) CreateDriver() (kvdb.Driver, error) {
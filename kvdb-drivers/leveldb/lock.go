@@ -0,0 +1,45 @@
+package leveldb
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+//lockStripes count of mutexes keys are distributed to.
+const lockStripes = 64
+
+//stripedLock mutexes which lock keys by hash,
+//so operations on different keys seldom wait for each other.
+type stripedLock [lockStripes]sync.Mutex
+
+func stripe(key []byte) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % lockStripes)
+}
+
+//get return mutex of given key.
+func (l *stripedLock) get(key []byte) *sync.Mutex {
+	return &l[stripe(key)]
+}
+
+//lockKeys lock mutexes of all given keys in stripe order to avoid deadlock.
+//Return function which unlocks them.
+func (l *stripedLock) lockKeys(keys [][]byte) func() {
+	var stripes [lockStripes]bool
+	for _, v := range keys {
+		stripes[stripe(v)] = true
+	}
+	for k, v := range stripes {
+		if v {
+			l[k].Lock()
+		}
+	}
+	return func() {
+		for k, v := range stripes {
+			if v {
+				l[k].Unlock()
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package leveldb
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+//ErrInvalidSize error raised if size in config is invalid.
+var ErrInvalidSize = errors.New("leveldb: invalid size")
+
+//ErrUnknownCompression error raised if compression in config is unknown.
+var ErrUnknownCompression = errors.New("leveldb: unknown compression")
+
+//ErrInvalidBloomFilterBits error raised if bloom filter bits in config is negative.
+var ErrInvalidBloomFilterBits = errors.New("leveldb: invalid bloom filter bits")
+
+//ErrInvalidOpenFilesCacheCapacity error raised if open files cache capacity in config is negative.
+var ErrInvalidOpenFilesCacheCapacity = errors.New("leveldb: invalid open files cache capacity")
+
+//CompressionSnappy compress blocks with snappy
+const CompressionSnappy = "snappy"
+
+//CompressionNone do not compress blocks
+const CompressionNone = "none"
+
+var compressions = map[string]opt.Compression{
+	"":                opt.DefaultCompression,
+	CompressionSnappy: opt.SnappyCompression,
+	CompressionNone:   opt.NoCompression,
+}
+
+var sizeUnits = []struct {
+	suffix string
+	size   int
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+//parseSize parse size like "64MB","512KB" or "1024" in bytes.
+//Units are case insensitive and power of 1024.
+//Size should be less than 2GB.
+//Return 0 if given string is empty.
+func parseSize(s string) (int, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	unit := 1
+	for _, v := range sizeUnits {
+		if strings.HasSuffix(s, v.suffix) {
+			unit = v.size
+			s = strings.TrimSpace(strings.TrimSuffix(s, v.suffix))
+			break
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > math.MaxInt32/unit {
+		return 0, ErrInvalidSize
+	}
+	return n * unit, nil
+}
+
+//Options create goleveldb options with config.
+//goleveldb default values will be used for empty fields.
+//Return options and any error if raised.
+func (c *Config) Options() (*opt.Options, error) {
+	var err error
+	o := &opt.Options{}
+	o.BlockCacheCapacity, err = parseSize(c.BlockCacheCapacity)
+	if err != nil {
+		return nil, err
+	}
+	o.WriteBuffer, err = parseSize(c.WriteBuffer)
+	if err != nil {
+		return nil, err
+	}
+	compression, ok := compressions[strings.ToLower(c.Compression)]
+	if !ok {
+		return nil, ErrUnknownCompression
+	}
+	o.Compression = compression
+	if c.BloomFilterBits < 0 {
+		return nil, ErrInvalidBloomFilterBits
+	}
+	if c.BloomFilterBits > 0 {
+		o.Filter = filter.NewBloomFilter(c.BloomFilterBits)
+	}
+	if c.OpenFilesCacheCapacity < 0 {
+		return nil, ErrInvalidOpenFilesCacheCapacity
+	}
+	o.OpenFilesCacheCapacity = c.OpenFilesCacheCapacity
+	o.ReadOnly = c.ReadOnly
+	return o, nil
+}
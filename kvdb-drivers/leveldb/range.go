@@ -0,0 +1,40 @@
+package leveldb
+
+import (
+	"github.com/herb-go/herbdata"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+//NextInRange return keys in given range after iter not more than given limit
+//Range start is inclusive and range limit is exclusive,nil start or limit means unbounded.
+//Empty iter (nil or 0 length []byte) will start a new search
+//Return keyvalue ,newiter and any error if raised.
+//Empty iter (nil or 0 length []byte) will be returned if no more keys
+func (d *Driver) NextInRange(r *util.Range, iter []byte, limit int) (result []*herbdata.KeyValue, newiter []byte, err error) {
+	return next(d.DB, r, iter, limit)
+}
+
+//PrevInRange return keys in given range before iter not more than given limit
+//Range start is inclusive and range limit is exclusive,nil start or limit means unbounded.
+//Empty iter (nil or 0 length []byte) will start a new search
+//Return keyvalue ,newiter and any error if raised.
+//Empty iter (nil or 0 length []byte) will be returned if no more keys
+func (d *Driver) PrevInRange(r *util.Range, iter []byte, limit int) (result []*herbdata.KeyValue, newiter []byte, err error) {
+	return prev(d.DB, r, iter, limit)
+}
+
+//NextWithPrefix return keys with given prefix after iter not more than given limit
+//Empty iter (nil or 0 length []byte) will start a new search
+//Return keyvalue ,newiter and any error if raised.
+//Empty iter (nil or 0 length []byte) will be returned if no more keys
+func (d *Driver) NextWithPrefix(prefix []byte, iter []byte, limit int) (result []*herbdata.KeyValue, newiter []byte, err error) {
+	return next(d.DB, util.BytesPrefix(prefix), iter, limit)
+}
+
+//PrevWithPrefix return keys with given prefix before iter not more than given limit
+//Empty iter (nil or 0 length []byte) will start a new search
+//Return keyvalue ,newiter and any error if raised.
+//Empty iter (nil or 0 length []byte) will be returned if no more keys
+func (d *Driver) PrevWithPrefix(prefix []byte, iter []byte, limit int) (result []*herbdata.KeyValue, newiter []byte, err error) {
+	return prev(d.DB, util.BytesPrefix(prefix), iter, limit)
+}
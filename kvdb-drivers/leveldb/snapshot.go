@@ -0,0 +1,46 @@
+package leveldb
+
+import (
+	"github.com/herb-go/herbdata"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+//Snapshot consistent point-in-time read-only view of database.
+//Snapshot should be released after used.
+type Snapshot struct {
+	snapshot *leveldb.Snapshot
+}
+
+//NewSnapshot create snapshot of current database state.
+//Return snapshot and any error if raised.
+func (d *Driver) NewSnapshot() (*Snapshot, error) {
+	s, err := d.DB.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{snapshot: s}, nil
+}
+
+//Get get value by given key in snapshot.
+//Values expire by current time even if they are unexpired when snapshot created.
+func (s *Snapshot) Get(key []byte) ([]byte, error) {
+	return get(s.snapshot, key)
+}
+
+//Next return keys in snapshot after iter not more than given limit
+//Iter is compatible with Driver.Next.
+func (s *Snapshot) Next(iter []byte, limit int) (result []*herbdata.KeyValue, newiter []byte, err error) {
+	return next(s.snapshot, nil, iter, limit)
+}
+
+//Prev return keys in snapshot before iter not more than given limit
+//Iter is compatible with Driver.Prev.
+func (s *Snapshot) Prev(iter []byte, limit int) (result []*herbdata.KeyValue, newiter []byte, err error) {
+	return prev(s.snapshot, nil, iter, limit)
+}
+
+//Release release snapshot.
+//Snapshot can not be used after released.
+func (s *Snapshot) Release() {
+	s.snapshot.Release()
+}
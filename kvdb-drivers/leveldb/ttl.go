@@ -0,0 +1,261 @@
+package leveldb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"github.com/herb-go/herbdata"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+//DefaultSweepInterval default interval to delete expired values in background
+var DefaultSweepInterval = time.Minute
+
+//ttlHeader magic bytes prefixed to values stored with ttl,
+//followed by 8 bytes big endian expiry time in unix nano.
+var ttlHeader = []byte{0xff, 'h', 't'}
+
+//expiryPrefix prefix of expiry index keys,
+//followed by 8 bytes big endian expiry time in unix nano and data key.
+var expiryPrefix = []byte{2}
+
+func hasTTLHeader(data []byte) bool {
+	return len(data) >= len(ttlHeader)+8 && bytes.HasPrefix(data, ttlHeader)
+}
+
+//encodeValue encode value with given expiry time.
+//Value without expiry is stored as it is unless it looks like an encoded one.
+func encodeValue(value []byte, expiredAt int64) []byte {
+	if expiredAt == 0 && !hasTTLHeader(value) {
+		return value
+	}
+	data := make([]byte, len(ttlHeader)+8, len(ttlHeader)+8+len(value))
+	copy(data, ttlHeader)
+	binary.BigEndian.PutUint64(data[len(ttlHeader):], uint64(expiredAt))
+	return append(data, value...)
+}
+
+//decodeValue decode value and expiry time from given data.
+//Expiry time is 0 if value never expires.
+func decodeValue(data []byte) (value []byte, expiredAt int64) {
+	if !hasTTLHeader(data) {
+		return data, 0
+	}
+	return data[len(ttlHeader)+8:], int64(binary.BigEndian.Uint64(data[len(ttlHeader):]))
+}
+
+func isExpired(expiredAt int64, now int64) bool {
+	return expiredAt != 0 && expiredAt <= now
+}
+
+func getExpiryKey(expiredAt int64, key []byte) []byte {
+	k := make([]byte, len(expiryPrefix)+8, len(expiryPrefix)+8+len(key))
+	copy(k, expiryPrefix)
+	binary.BigEndian.PutUint64(k[len(expiryPrefix):], uint64(expiredAt))
+	return append(k, key...)
+}
+
+func getExpiredAt(ttlInSecond int64) int64 {
+	return time.Now().Add(time.Duration(ttlInSecond) * time.Second).UnixNano()
+}
+
+//put put value with given expiry time.
+//Expiry index will be written in same batch if expiry time is not 0.
+func (d *Driver) put(key []byte, value []byte, expiredAt int64) error {
+	data := encodeValue(value, expiredAt)
+	if expiredAt == 0 {
+		return d.DB.Put(key, data, nil)
+	}
+	b := new(leveldb.Batch)
+	b.Put(key, data)
+	b.Put(getExpiryKey(expiredAt, key), nil)
+	return d.DB.Write(b, nil)
+}
+
+//has check if unexpired value with given key exists.
+func (d *Driver) has(key []byte) (bool, error) {
+	data, err := d.DB.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, expiredAt := decodeValue(data)
+	return !isExpired(expiredAt, time.Now().UnixNano()), nil
+}
+
+func (d *Driver) set(key []byte, value []byte, expiredAt int64) error {
+	if d.readOnly() {
+		return ErrReadOnly
+	}
+	if isReservedKey(key) {
+		return ErrReservedKey
+	}
+	l := d.locks.get(key)
+	l.Lock()
+	defer l.Unlock()
+	return d.put(key, value, expiredAt)
+}
+
+func (d *Driver) insert(key []byte, value []byte, expiredAt int64) (bool, error) {
+	if d.readOnly() {
+		return false, ErrReadOnly
+	}
+	if isReservedKey(key) {
+		return false, ErrReservedKey
+	}
+	l := d.locks.get(key)
+	l.Lock()
+	defer l.Unlock()
+	ok, err := d.has(key)
+	if err != nil || ok {
+		return false, err
+	}
+	err = d.put(key, value, expiredAt)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (d *Driver) update(key []byte, value []byte, expiredAt int64) (bool, error) {
+	if d.readOnly() {
+		return false, ErrReadOnly
+	}
+	if isReservedKey(key) {
+		return false, ErrReservedKey
+	}
+	l := d.locks.get(key)
+	l.Lock()
+	defer l.Unlock()
+	ok, err := d.has(key)
+	if err != nil || !ok {
+		return false, err
+	}
+	err = d.put(key, value, expiredAt)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//SetWithTTL set value by given key and ttl in second
+func (d *Driver) SetWithTTL(key []byte, value []byte, ttlInSecond int64) error {
+	if ttlInSecond <= 0 {
+		return herbdata.ErrInvalidatedTTL
+	}
+	return d.set(key, value, getExpiredAt(ttlInSecond))
+}
+
+//InsertWithTTL insert value with given key and ttl in second.
+//Insert will fail if unexpired data with given key exists.
+//Return if operation success and any error if raised
+func (d *Driver) InsertWithTTL(key []byte, value []byte, ttlInSecond int64) (bool, error) {
+	if ttlInSecond <= 0 {
+		return false, herbdata.ErrInvalidatedTTL
+	}
+	return d.insert(key, value, getExpiredAt(ttlInSecond))
+}
+
+//UpdateWithTTL update value with given key and ttl in second.
+//Update will fail if unexpired data with given key does nto exist.
+//Return if operation success and any error if raised
+func (d *Driver) UpdateWithTTL(key []byte, value []byte, ttlInSecond int64) (bool, error) {
+	if ttlInSecond <= 0 {
+		return false, herbdata.ErrInvalidatedTTL
+	}
+	return d.update(key, value, getExpiredAt(ttlInSecond))
+}
+
+//Sweep delete expired values through expiry index.
+//Return count of deleted values and any error if raised.
+func (d *Driver) Sweep() (int, error) {
+	if d.readOnly() {
+		return 0, ErrReadOnly
+	}
+	now := time.Now().UnixNano()
+	it := d.DB.NewIterator(&util.Range{Start: expiryPrefix, Limit: getExpiryKey(now+1, nil)}, nil)
+	defer it.Release()
+	var count int
+	for it.Next() {
+		indexkey := append([]byte{}, it.Key()...)
+		if len(indexkey) < len(expiryPrefix)+8 {
+			continue
+		}
+		expiredAt := int64(binary.BigEndian.Uint64(indexkey[len(expiryPrefix):]))
+		deleted, err := d.sweep(indexkey[len(expiryPrefix)+8:], indexkey, expiredAt)
+		if err != nil {
+			return count, err
+		}
+		if deleted {
+			count++
+		}
+	}
+	return count, it.Error()
+}
+
+//sweep delete expiry index key,and value with given key if value is stored with ttl and still expires at given time.
+//Return if value is deleted and any error if raised.
+func (d *Driver) sweep(key []byte, indexkey []byte, expiredAt int64) (bool, error) {
+	l := d.locks.get(key)
+	l.Lock()
+	defer l.Unlock()
+	b := new(leveldb.Batch)
+	b.Delete(indexkey)
+	data, err := d.DB.Get(key, nil)
+	if err != nil && err != leveldb.ErrNotFound {
+		return false, err
+	}
+	var deleted bool
+	//value may be overwritten after index key written,
+	//and index key may be written without value by other programs,
+	//so value is only deleted if it has ttl header with same expiry time.
+	if err == nil && hasTTLHeader(data) {
+		_, e := decodeValue(data)
+		if e == expiredAt {
+			b.Delete(key)
+			deleted = true
+		}
+	}
+	err = d.DB.Write(b, nil)
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
+
+//startSweeper start deleting expired values every SweepInterval in background.
+func (d *Driver) startSweeper() {
+	if d.SweepInterval <= 0 {
+		return
+	}
+	d.stopped = make(chan struct{})
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for {
+			select {
+			case <-d.stopped:
+				return
+			case <-time.After(d.SweepInterval):
+			}
+			_, err := d.Sweep()
+			if err != nil {
+				d.handleError(err)
+			}
+		}
+	}()
+}
+
+//stopSweeper stop sweeper and wait until running sweep finished.
+func (d *Driver) stopSweeper() {
+	if d.stopped == nil {
+		return
+	}
+	close(d.stopped)
+	d.wg.Wait()
+	d.stopped = nil
+}
@@ -0,0 +1,230 @@
+package redisdb
+
+import (
+	"github.com/gomodule/redigo/redis"
+	"github.com/herb-go/herbdata"
+)
+
+//BatchDriver driver which supports batch operations.
+//Callers can detect batch support by type assertion.
+type BatchDriver interface {
+	//SetMulti set values by given key values.
+	SetMulti(kvs []*herbdata.KeyValue) error
+	//SetMultiWithTTL set values by given key values and ttl in second.
+	SetMultiWithTTL(kvs []*herbdata.KeyValue, ttlInSecond int64) error
+	//GetMulti get values by given keys.
+	GetMulti(keys [][]byte) ([][]byte, []error, error)
+	//DeleteMulti delete values by given keys.
+	DeleteMulti(keys [][]byte) error
+}
+
+var _ BatchDriver = &Driver{}
+
+//SetMulti set values by given key values.
+//Values are sent with pipelined SET commands.
+func (d *Driver) SetMulti(kvs []*herbdata.KeyValue) error {
+	return d.setMulti(kvs)
+}
+
+//SetMultiWithTTL set values by given key values and ttl in second.
+//Values are sent with pipelined SET ... EX commands.
+func (d *Driver) SetMultiWithTTL(kvs []*herbdata.KeyValue, ttlInSecond int64) error {
+	if ttlInSecond <= 0 {
+		return herbdata.ErrInvalidatedTTL
+	}
+	return d.setMulti(kvs, "EX", ttlInSecond)
+}
+
+func (d *Driver) setMulti(kvs []*herbdata.KeyValue, opts ...interface{}) error {
+	if len(kvs) == 0 {
+		return nil
+	}
+	keys := make([]string, len(kvs))
+	args := make([][]interface{}, len(kvs))
+	for k, v := range kvs {
+		data, err := d.encodeValue(v.Key, v.Value)
+		if err != nil {
+			return err
+		}
+		keys[k] = d.getKey(v.Key)
+		args[k] = append([]interface{}{data}, opts...)
+	}
+	defer d.invalidate(keys...)
+	_, errs, err := d.pipeline("SET", keys, args)
+	if err != nil {
+		return err
+	}
+	for _, v := range errs {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+//GetMulti get values by given keys.
+//Return values and errors in same order as keys,and any error if raised.
+//Value will be nil and error will be herbdata.ErrNotFound if key not found.
+func (d *Driver) GetMulti(keys [][]byte) ([][]byte, []error, error) {
+	if len(keys) == 0 {
+		return nil, nil, nil
+	}
+	rkeys := make([]string, len(keys))
+	for k := range keys {
+		rkeys[k] = d.getKey(keys[k])
+	}
+	values := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	if d.Cluster != nil {
+		replies, replyerrs, err := d.pipeline("GET", rkeys, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k := range replies {
+			if replyerrs[k] != nil {
+				errs[k] = replyerrs[k]
+				continue
+			}
+			values[k], errs[k] = d.decodeReply(keys[k], replies[k])
+		}
+		return values, errs, nil
+	}
+	args := make([]interface{}, len(rkeys))
+	for k := range rkeys {
+		args[k] = rkeys[k]
+	}
+	conn := d.getReadConn("")
+	defer conn.Close()
+	replies, err := redis.Values(conn.Do("MGET", args...))
+	if err != nil {
+		return nil, nil, convertError(err)
+	}
+	for k := range replies {
+		values[k], errs[k] = d.decodeReply(keys[k], replies[k])
+	}
+	return values, errs, nil
+}
+
+//decodeReply convert GET reply of given key to value and decode it.
+func (d *Driver) decodeReply(key []byte, reply interface{}) ([]byte, error) {
+	data, err := redis.Bytes(reply, nil)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return d.decodeValue(key, data)
+}
+
+//DeleteMulti delete values by given keys.
+//Keys are deleted with one multi-key DEL command,or pipelined DEL commands in cluster mode.
+func (d *Driver) DeleteMulti(keys [][]byte) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	rkeys := make([]string, len(keys))
+	for k := range keys {
+		rkeys[k] = d.getKey(keys[k])
+	}
+	defer d.invalidate(rkeys...)
+	if d.Cluster != nil {
+		_, errs, err := d.pipeline("DEL", rkeys, nil)
+		if err != nil {
+			return err
+		}
+		for _, v := range errs {
+			if v != nil {
+				return v
+			}
+		}
+		return nil
+	}
+	args := make([]interface{}, len(rkeys))
+	for k := range rkeys {
+		args[k] = rkeys[k]
+	}
+	conn := d.getConn("")
+	defer conn.Close()
+	_, err := conn.Do("DEL", args...)
+	return convertError(err)
+}
+
+//pipeline send given command for every key with args in pipeline.
+//Return replies and command errors in same order as keys,and any connection error if raised.
+//In cluster mode commands are grouped by node,
+//and commands redirected by MOVED or ASK are retried one by one.
+func (d *Driver) pipeline(cmd string, keys []string, args [][]interface{}) ([]interface{}, []error, error) {
+	replies := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	if d.Cluster == nil {
+		indexes := make([]int, len(keys))
+		for k := range keys {
+			indexes[k] = k
+		}
+		conn := d.getConn("")
+		defer conn.Close()
+		err := pipelineSend(conn, cmd, keys, args, indexes, replies, errs)
+		return replies, errs, err
+	}
+	groups := map[string][]int{}
+	for k := range keys {
+		addr, err := d.Cluster.addr(keys[k])
+		if err != nil {
+			return nil, nil, err
+		}
+		groups[addr] = append(groups[addr], k)
+	}
+	for addr, indexes := range groups {
+		conn := d.getNodeConn(addr)
+		err := pipelineSend(conn, cmd, keys, args, indexes, replies, errs)
+		conn.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for k := range keys {
+		if _, _, _, ok := parseRedirect(errs[k]); !ok {
+			continue
+		}
+		conn := d.getConn(keys[k])
+		replies[k], errs[k] = conn.Do(cmd, commandArgs(keys, args, k)...)
+		conn.Close()
+		if errs[k] != nil {
+			if _, ok := errs[k].(redis.Error); !ok {
+				return nil, nil, errs[k]
+			}
+		}
+	}
+	return replies, errs, nil
+}
+
+func commandArgs(keys []string, args [][]interface{}, index int) []interface{} {
+	cmdargs := []interface{}{keys[index]}
+	if args != nil {
+		cmdargs = append(cmdargs, args[index]...)
+	}
+	return cmdargs
+}
+
+//pipelineSend send commands of given indexes with connection in pipeline,
+//and save replies and command errors to given slices.
+//Return any connection error if raised.
+func pipelineSend(conn redis.Conn, cmd string, keys []string, args [][]interface{}, indexes []int, replies []interface{}, errs []error) error {
+	for _, i := range indexes {
+		err := conn.Send(cmd, commandArgs(keys, args, i)...)
+		if err != nil {
+			return err
+		}
+	}
+	err := conn.Flush()
+	if err != nil {
+		return err
+	}
+	for _, i := range indexes {
+		replies[i], errs[i] = conn.Receive()
+		if errs[i] != nil {
+			if _, ok := errs[i].(redis.Error); !ok {
+				return errs[i]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package redisdb
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/herb-go/herbdata"
+	"github.com/herb-go/herbdata/kvdb"
+)
+
+func testBatch(t *testing.T, d *Driver) {
+	var driver kvdb.Driver = d
+	if _, ok := driver.(BatchDriver); !ok {
+		t.Fatal(ok)
+	}
+	kvs := []*herbdata.KeyValue{}
+	keys := [][]byte{}
+	for i := 0; i < 20; i++ {
+		key := []byte("key" + strconv.Itoa(i))
+		kvs = append(kvs, &herbdata.KeyValue{Key: key, Value: []byte("value" + strconv.Itoa(i))})
+		keys = append(keys, key)
+	}
+	err := d.SetMulti(kvs[:10])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.SetMultiWithTTL(kvs[10:], 0)
+	if err != herbdata.ErrInvalidatedTTL {
+		t.Fatal(err)
+	}
+	err = d.SetMultiWithTTL(kvs[10:15], 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, errs, err := d.GetMulti(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 20 || len(errs) != 20 {
+		t.Fatal(len(values), len(errs))
+	}
+	for i := 0; i < 20; i++ {
+		if i < 15 {
+			if errs[i] != nil || string(values[i]) != "value"+strconv.Itoa(i) {
+				t.Fatal(i, string(values[i]), errs[i])
+			}
+		} else {
+			if errs[i] != herbdata.ErrNotFound || values[i] != nil {
+				t.Fatal(i, values[i], errs[i])
+			}
+		}
+	}
+	conn := d.getConn(d.getKey(keys[12]))
+	ttl, err := redis.Int64(conn.Do("TTL", d.getKey(keys[12])))
+	conn.Close()
+	if err != nil || ttl <= 0 || ttl > 100 {
+		t.Fatal(ttl, err)
+	}
+	err = d.DeleteMulti(keys[:5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, errs, err = d.GetMulti(keys[:6])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if errs[i] != herbdata.ErrNotFound || values[i] != nil {
+			t.Fatal(i, values[i], errs[i])
+		}
+	}
+	if errs[5] != nil || string(values[5]) != "value5" {
+		t.Fatal(string(values[5]), errs[5])
+	}
+	values, errs, err = d.GetMulti(nil)
+	if values != nil || errs != nil || err != nil {
+		t.Fatal(values, errs, err)
+	}
+	if d.SetMulti(nil) != nil || d.DeleteMulti(nil) != nil {
+		t.Fatal()
+	}
+}
+
+func TestBatch(t *testing.T) {
+	d := newTestDriver("batch")
+	defer d.Close()
+	conn := d.Pool.Get()
+	_, err := conn.Do("FLUSHDB")
+	conn.Close()
+	if err != nil {
+		panic(err)
+	}
+	testBatch(t, d)
+}
+
+func TestClusterBatch(t *testing.T) {
+	d, fake := newTestClusterDriver()
+	defer d.Close()
+	testBatch(t, d)
+	if fake.misrouted != 0 {
+		t.Fatal(fake.misrouted)
+	}
+	//keys moved to other node should be retried one by one
+	fake.lock.Lock()
+	for i := 0; i < ClusterSlots; i++ {
+		if fake.owner[i] == "127.0.0.1:7001" {
+			fake.owner[i] = "127.0.0.1:7002"
+		} else {
+			fake.owner[i] = "127.0.0.1:7001"
+		}
+	}
+	fake.lock.Unlock()
+	values, errs, err := d.GetMulti([][]byte{[]byte("key10"), []byte("key11"), []byte("key0")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs[0] != nil || string(values[0]) != "value10" || errs[1] != nil || string(values[1]) != "value11" || errs[2] != herbdata.ErrNotFound {
+		t.Fatal(values, errs)
+	}
+	if fake.moved == 0 {
+		t.Fatal(fake.moved)
+	}
+}
@@ -0,0 +1,220 @@
+package redisdb
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//ErrCircuitOpen error raised without connecting redis while circuit breaker is open.
+var ErrCircuitOpen = errors.New("redisdb: circuit breaker is open")
+
+//BreakerState circuit breaker state
+type BreakerState int
+
+//BreakerClosed operations are allowed.
+const BreakerClosed = BreakerState(0)
+
+//BreakerOpen operations fail fast with ErrCircuitOpen.
+const BreakerOpen = BreakerState(1)
+
+//BreakerHalfOpen redis is being probed with PING after open timeout.
+const BreakerHalfOpen = BreakerState(2)
+
+//String return state name
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+//DefaultBreakerThreshold default count of consecutive connection errors to open circuit breaker
+const DefaultBreakerThreshold = 5
+
+//DefaultBreakerOpenTimeout default duration circuit breaker stays open before probing redis
+const DefaultBreakerOpenTimeout = 5 * time.Second
+
+//Breaker circuit breaker which counts consecutive connection errors.
+//Errors replied by redis like WRONGTYPE are not connection errors.
+type Breaker struct {
+	//Threshold count of consecutive connection errors to open breaker.
+	Threshold int
+	//OpenTimeout duration breaker stays open before probing redis.
+	OpenTimeout time.Duration
+	lock        sync.Mutex
+	state       BreakerState
+	failures    int
+	openedAt    time.Time
+}
+
+//NewBreaker create new circuit breaker with default threshold and open timeout.
+func NewBreaker() *Breaker {
+	return &Breaker{
+		Threshold:   DefaultBreakerThreshold,
+		OpenTimeout: DefaultBreakerOpenTimeout,
+	}
+}
+
+//State return current breaker state.
+func (b *Breaker) State() BreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state
+}
+
+//Reset close breaker and clear error count.
+func (b *Breaker) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.state = BreakerClosed
+	b.failures = 0
+}
+
+//allow check if operation is allowed.
+//If open timeout passed,breaker turns half-open and redis is probed with given probe function,
+//while other operations still fail fast.
+//Return ErrCircuitOpen if operation is not allowed.
+func (b *Breaker) allow(probe func() error) error {
+	b.lock.Lock()
+	switch b.state {
+	case BreakerClosed:
+		b.lock.Unlock()
+		return nil
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.OpenTimeout {
+			b.lock.Unlock()
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+	default:
+		b.lock.Unlock()
+		return ErrCircuitOpen
+	}
+	b.lock.Unlock()
+	err := probe()
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err != nil {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		return ErrCircuitOpen
+	}
+	b.state = BreakerClosed
+	b.failures = 0
+	return nil
+}
+
+//report report operation result to breaker.
+func (b *Breaker) report(err error) {
+	if !isConnectionError(err) {
+		b.lock.Lock()
+		if b.state == BreakerClosed {
+			b.failures = 0
+		}
+		b.lock.Unlock()
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.state != BreakerClosed {
+		return
+	}
+	b.failures++
+	if b.failures >= b.Threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func isConnectionError(err error) bool {
+	if err == nil || err == redis.ErrNil || err == ErrCircuitOpen {
+		return false
+	}
+	_, ok := err.(redis.Error)
+	return !ok
+}
+
+//breakerConn connection which reports errors to breaker.
+type breakerConn struct {
+	redis.Conn
+	breaker *Breaker
+}
+
+func (c *breakerConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(commandName, args...)
+	c.breaker.report(err)
+	return reply, err
+}
+
+func (c *breakerConn) Send(commandName string, args ...interface{}) error {
+	err := c.Conn.Send(commandName, args...)
+	if err != nil {
+		c.breaker.report(err)
+	}
+	return err
+}
+
+func (c *breakerConn) Flush() error {
+	err := c.Conn.Flush()
+	if err != nil {
+		c.breaker.report(err)
+	}
+	return err
+}
+
+func (c *breakerConn) Receive() (interface{}, error) {
+	reply, err := c.Conn.Receive()
+	c.breaker.report(err)
+	return reply, err
+}
+
+//guard get connection with given function through circuit breaker.
+//Connection returns ErrCircuitOpen for all commands if breaker is open.
+func (d *Driver) guard(get func() redis.Conn) redis.Conn {
+	if d.Breaker == nil {
+		return get()
+	}
+	err := d.Breaker.allow(func() error {
+		conn := get()
+		defer conn.Close()
+		_, err := conn.Do("PING")
+		return err
+	})
+	if err != nil {
+		return errorConn{err: err}
+	}
+	return &breakerConn{Conn: get(), breaker: d.Breaker}
+}
+
+//Ping send PING to redis.
+//In cluster mode all master nodes will be pinged.
+//Return ErrCircuitOpen without connecting redis if circuit breaker is open.
+func (d *Driver) Ping() error {
+	if d.Cluster == nil {
+		conn := d.getConn("")
+		defer conn.Close()
+		_, err := conn.Do("PING")
+		return err
+	}
+	masters, err := d.Cluster.Masters()
+	if err != nil {
+		return err
+	}
+	for _, v := range masters {
+		conn := d.getNodeConn(v)
+		_, err = conn.Do("PING")
+		conn.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
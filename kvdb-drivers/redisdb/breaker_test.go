@@ -0,0 +1,113 @@
+package redisdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestBreakerDriver(m *miniredis.Miniredis) *Driver {
+	c := &Config{}
+	c.Network = "tcp"
+	c.Address = m.Addr()
+	c.MaxIdle = 10
+	c.Prefix = "breaker"
+	c.CircuitBreaker = true
+	c.BreakerThreshold = 3
+	d, err := c.CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	driver := d.(*Driver)
+	driver.Breaker.OpenTimeout = 100 * time.Millisecond
+	return driver
+}
+
+func TestBreaker(t *testing.T) {
+	m := miniredis.RunT(t)
+	d := newTestBreakerDriver(m)
+	defer d.Close()
+	if d.Breaker.Threshold != 3 || d.Breaker.State() != BreakerClosed {
+		t.Fatal(d.Breaker)
+	}
+	err := d.Set([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//errors replied by redis should not open breaker
+	m.Set(d.getCounterKey([]byte("counter")), "notnumber")
+	for i := 0; i < 5; i++ {
+		_, err = d.IncreaseCounter([]byte("counter"), 1)
+		if err == nil || err == ErrCircuitOpen {
+			t.Fatal(err)
+		}
+	}
+	if d.Breaker.State() != BreakerClosed {
+		t.Fatal(d.Breaker.State())
+	}
+	m.Close()
+	for i := 0; i < 3; i++ {
+		_, err = d.Get([]byte("key"))
+		if err == nil || err == ErrCircuitOpen {
+			t.Fatal(i, err)
+		}
+	}
+	if d.Breaker.State() != BreakerOpen {
+		t.Fatal(d.Breaker.State())
+	}
+	_, err = d.Get([]byte("key"))
+	if err != ErrCircuitOpen {
+		t.Fatal(err)
+	}
+	if d.Ping() != ErrCircuitOpen {
+		t.Fatal(err)
+	}
+	//probe fails while redis is still down
+	time.Sleep(150 * time.Millisecond)
+	_, err = d.Get([]byte("key"))
+	if err != ErrCircuitOpen || d.Breaker.State() != BreakerOpen {
+		t.Fatal(err, d.Breaker.State())
+	}
+	err = m.Restart()
+	if err != nil {
+		panic(err)
+	}
+	_, err = d.Get([]byte("key"))
+	if err != ErrCircuitOpen {
+		t.Fatal(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	data, err := d.Get([]byte("key"))
+	if err != nil || string(data) != "value" {
+		t.Fatal(string(data), err)
+	}
+	if d.Breaker.State() != BreakerClosed {
+		t.Fatal(d.Breaker.State())
+	}
+	m.Close()
+	d.Ping()
+	d.Ping()
+	d.Ping()
+	if d.Breaker.State() != BreakerOpen {
+		t.Fatal(d.Breaker.State())
+	}
+	d.Breaker.Reset()
+	if d.Breaker.State() != BreakerClosed {
+		t.Fatal(d.Breaker.State())
+	}
+}
+
+func TestBreakerState(t *testing.T) {
+	if BreakerClosed.String() != "closed" || BreakerOpen.String() != "open" || BreakerHalfOpen.String() != "half-open" || BreakerState(-1).String() != "unknown" {
+		t.Fatal()
+	}
+	b := NewBreaker()
+	if b.Threshold != DefaultBreakerThreshold || b.OpenTimeout != DefaultBreakerOpenTimeout {
+		t.Fatal(b)
+	}
+}
@@ -0,0 +1,363 @@
+package redisdb
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//ClusterSlots count of redis cluster hash slots
+const ClusterSlots = 16384
+
+//DefaultClusterMaxRedirects default max MOVED/ASK redirects followed by one command
+const DefaultClusterMaxRedirects = 5
+
+//ErrNoClusterNode error raised if no cluster node available
+var ErrNoClusterNode = errors.New("redisdb: no cluster node available")
+
+//ErrClusterDb error raised if db is not 0 in cluster mode
+var ErrClusterDb = errors.New("redisdb: db should be 0 in cluster mode")
+
+//Cluster redis cluster client.
+//Cluster keeps a connection pool per node and routes commands by key hash slot.
+type Cluster struct {
+	//Seeds addresses used to discover cluster slots.
+	Seeds []string
+	//NewPool create connection pool for given node address.
+	NewPool func(addr string) *redis.Pool
+	//MaxRedirects max MOVED/ASK redirects followed by one command.
+	MaxRedirects int
+	lock         sync.RWMutex
+	slots        []string
+	masters      []string
+	pools        map[string]*redis.Pool
+	stale        bool
+}
+
+//NewCluster create new cluster with given seed addresses and pool creator.
+func NewCluster(seeds []string, newpool func(addr string) *redis.Pool) *Cluster {
+	return &Cluster{
+		Seeds:        seeds,
+		NewPool:      newpool,
+		MaxRedirects: DefaultClusterMaxRedirects,
+		slots:        make([]string, ClusterSlots),
+		pools:        map[string]*redis.Pool{},
+		stale:        true,
+	}
+}
+
+func (c *Cluster) pool(addr string) *redis.Pool {
+	c.lock.RLock()
+	p, ok := c.pools[addr]
+	c.lock.RUnlock()
+	if ok {
+		return p
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	p, ok = c.pools[addr]
+	if !ok {
+		p = c.NewPool(addr)
+		c.pools[addr] = p
+	}
+	return p
+}
+
+func (c *Cluster) nodes() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	nodes := make([]string, 0, len(c.masters)+len(c.Seeds))
+	nodes = append(nodes, c.masters...)
+	return append(nodes, c.Seeds...)
+}
+
+//Refresh load slots layout with CLUSTER SLOTS from known nodes.
+//Return any error if raised.
+func (c *Cluster) Refresh() error {
+	var err error
+	for _, addr := range c.nodes() {
+		err = c.refreshFrom(addr)
+		if err == nil {
+			return nil
+		}
+	}
+	if err == nil {
+		return ErrNoClusterNode
+	}
+	return err
+}
+
+func (c *Cluster) refreshFrom(addr string) error {
+	conn := c.pool(addr).Get()
+	defer conn.Close()
+	ranges, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	slots := make([]string, ClusterSlots)
+	masters := map[string]bool{}
+	for _, v := range ranges {
+		var start, end int
+		var master []interface{}
+		_, err = redis.Scan(v.([]interface{}), &start, &end, &master)
+		if err != nil {
+			return err
+		}
+		var ip string
+		var port int
+		_, err = redis.Scan(master, &ip, &port)
+		if err != nil {
+			return err
+		}
+		//Empty ip means the node is the one we asked.
+		if ip == "" {
+			ip = host
+		}
+		node := net.JoinHostPort(ip, strconv.Itoa(port))
+		masters[node] = true
+		for i := start; i <= end && i < ClusterSlots; i++ {
+			slots[i] = node
+		}
+	}
+	list := make([]string, 0, len(masters))
+	for k := range masters {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	c.lock.Lock()
+	c.slots = slots
+	c.masters = list
+	c.stale = false
+	c.lock.Unlock()
+	return nil
+}
+
+//Masters return sorted master node addresses.
+func (c *Cluster) Masters() ([]string, error) {
+	err := c.refreshIfStale()
+	if err != nil {
+		return nil, err
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append([]string{}, c.masters...), nil
+}
+
+func (c *Cluster) refreshIfStale() error {
+	c.lock.RLock()
+	stale := c.stale
+	c.lock.RUnlock()
+	if stale {
+		return c.Refresh()
+	}
+	return nil
+}
+
+func (c *Cluster) moved(slot int, addr string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if slot >= 0 && slot < ClusterSlots {
+		c.slots[slot] = addr
+	}
+	c.stale = true
+}
+
+//addr return node address of given redis key.
+//Return address and any error if raised.
+func (c *Cluster) addr(key string) (string, error) {
+	err := c.refreshIfStale()
+	if err != nil {
+		return "", err
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	addr := c.slots[Slot(key)]
+	if addr != "" {
+		return addr, nil
+	}
+	if len(c.masters) > 0 {
+		return c.masters[0], nil
+	}
+	if len(c.Seeds) > 0 {
+		return c.Seeds[0], nil
+	}
+	return "", ErrNoClusterNode
+}
+
+//GetNode get connection of given node address.
+func (c *Cluster) GetNode(addr string) redis.Conn {
+	return c.pool(addr).Get()
+}
+
+//Get get connection for given redis key.
+//Commands sent with Do will follow MOVED and ASK redirects unless inside a MULTI transaction
+//or after pipelined commands sent by Send.
+func (c *Cluster) Get(key string) redis.Conn {
+	addr, err := c.addr(key)
+	if err != nil {
+		return errorConn{err: err}
+	}
+	return &clusterConn{
+		cluster: c,
+		conn:    c.GetNode(addr),
+	}
+}
+
+//Close close all node pools.
+func (c *Cluster) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var result error
+	for k, v := range c.pools {
+		err := v.Close()
+		if err != nil {
+			result = err
+		}
+		delete(c.pools, k)
+	}
+	return result
+}
+
+//errorConn connection which always returns given error
+type errorConn struct {
+	err error
+}
+
+func (c errorConn) Do(string, ...interface{}) (interface{}, error) { return nil, c.err }
+func (c errorConn) Send(string, ...interface{}) error              { return c.err }
+func (c errorConn) Err() error                                     { return c.err }
+func (c errorConn) Close() error                                   { return nil }
+func (c errorConn) Flush() error                                   { return c.err }
+func (c errorConn) Receive() (interface{}, error)                  { return nil, c.err }
+
+type clusterConn struct {
+	cluster *Cluster
+	conn    redis.Conn
+	pending int
+	multi   bool
+}
+
+func (c *clusterConn) track(cmd string) {
+	switch strings.ToUpper(cmd) {
+	case "MULTI":
+		c.multi = true
+	case "EXEC", "DISCARD":
+		c.multi = false
+	}
+}
+
+func (c *clusterConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *clusterConn) Err() error {
+	return c.conn.Err()
+}
+
+func (c *clusterConn) Send(cmd string, args ...interface{}) error {
+	c.track(cmd)
+	c.pending++
+	return c.conn.Send(cmd, args...)
+}
+
+func (c *clusterConn) Flush() error {
+	return c.conn.Flush()
+}
+
+func (c *clusterConn) Receive() (interface{}, error) {
+	if c.pending > 0 {
+		c.pending--
+	}
+	return c.conn.Receive()
+}
+
+func (c *clusterConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	retryable := c.pending == 0 && !c.multi
+	c.track(cmd)
+	c.pending = 0
+	reply, err := c.conn.Do(cmd, args...)
+	for i := 0; i < c.cluster.MaxRedirects; i++ {
+		redirect, slot, addr, ok := parseRedirect(err)
+		if !ok {
+			break
+		}
+		if redirect == "MOVED" {
+			c.cluster.moved(slot, addr)
+		}
+		if !retryable {
+			break
+		}
+		if redirect == "MOVED" {
+			c.conn.Close()
+			c.conn = c.cluster.GetNode(addr)
+			reply, err = c.conn.Do(cmd, args...)
+			continue
+		}
+		reply, err = c.ask(addr, cmd, args...)
+	}
+	return reply, err
+}
+
+func (c *clusterConn) ask(addr string, cmd string, args ...interface{}) (interface{}, error) {
+	conn := c.cluster.GetNode(addr)
+	defer conn.Close()
+	err := conn.Send("ASKING")
+	if err != nil {
+		return nil, err
+	}
+	return conn.Do(cmd, args...)
+}
+
+//parseRedirect parse MOVED or ASK error returned by cluster node.
+func parseRedirect(err error) (redirect string, slot int, addr string, ok bool) {
+	rerr, isredis := err.(redis.Error)
+	if !isredis {
+		return "", 0, "", false
+	}
+	fields := strings.Fields(string(rerr))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return "", 0, "", false
+	}
+	slot, converr := strconv.Atoi(fields[1])
+	if converr != nil {
+		return "", 0, "", false
+	}
+	return fields[0], slot, fields[2], true
+}
+
+//Slot return cluster hash slot of given redis key.
+//Only the hash tag will be hashed if key contains one,
+//so keys with same hash tag like "{user1}.name" and "{user1}.age" land on same slot.
+func Slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % ClusterSlots)
+}
+
+//crc16 CRC16-CCITT (XMODEM) checksum used by redis cluster
+func crc16(data string) uint16 {
+	var crc uint16
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc = crc << 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,381 @@
+package redisdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/herb-go/herbdata"
+	"github.com/herb-go/herbdata-drivers/kvdb-drivers/internal/redisscan"
+	"github.com/herb-go/herbdata/kvdb"
+	"github.com/herb-go/herbdata/kvdb/featuretestutil"
+)
+
+//fakeCluster simulates slots layout of a two nodes cluster on top of a single redis server.
+type fakeCluster struct {
+	lock      sync.Mutex
+	owner     []string
+	asking    map[int]string
+	moved     int
+	asked     int
+	misrouted int
+	base      *redis.Pool
+}
+
+func newFakeCluster(base *redis.Pool) *fakeCluster {
+	c := &fakeCluster{
+		owner:  make([]string, ClusterSlots),
+		asking: map[int]string{},
+		base:   base,
+	}
+	for i := range c.owner {
+		if i < ClusterSlots/2 {
+			c.owner[i] = "127.0.0.1:7001"
+		} else {
+			c.owner[i] = "127.0.0.1:7002"
+		}
+	}
+	return c
+}
+
+func (c *fakeCluster) newPool(addr string) *redis.Pool {
+	return &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			conn, err := c.base.Dial()
+			if err != nil {
+				return nil, err
+			}
+			return &fakeNodeConn{Conn: conn, cluster: c, node: addr}, nil
+		},
+	}
+}
+
+func (c *fakeCluster) slots() []interface{} {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	result := []interface{}{}
+	start := 0
+	for i := 1; i <= ClusterSlots; i++ {
+		if i == ClusterSlots || c.owner[i] != c.owner[start] {
+			host, port := splitAddr(c.owner[start])
+			result = append(result, []interface{}{int64(start), int64(i - 1), []interface{}{[]byte(host), port}})
+			start = i
+		}
+	}
+	return result
+}
+
+func splitAddr(addr string) (string, int64) {
+	data := strings.Split(addr, ":")
+	port, _ := strconv.ParseInt(data[1], 10, 64)
+	return data[0], port
+}
+
+type fakeNodeConn struct {
+	redis.Conn
+	cluster *fakeCluster
+	node    string
+	asking  bool
+}
+
+func (c *fakeNodeConn) check(cmd string, args []interface{}) error {
+	switch strings.ToUpper(cmd) {
+	case "SCAN", "MULTI", "EXEC", "DISCARD", "PING", "FLUSHDB":
+		return nil
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	slot := Slot(fmt.Sprint(args[0]))
+	asking := c.asking
+	c.asking = false
+	c.cluster.lock.Lock()
+	defer c.cluster.lock.Unlock()
+	if target, ok := c.cluster.asking[slot]; ok {
+		if target == c.node && asking {
+			return nil
+		}
+		if c.cluster.owner[slot] == c.node {
+			c.cluster.asked++
+			return redis.Error(fmt.Sprintf("ASK %d %s", slot, target))
+		}
+	}
+	if c.cluster.owner[slot] != c.node {
+		c.cluster.moved++
+		return redis.Error(fmt.Sprintf("MOVED %d %s", slot, c.cluster.owner[slot]))
+	}
+	return nil
+}
+
+func (c *fakeNodeConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	switch strings.ToUpper(cmd) {
+	case "CLUSTER":
+		return c.cluster.slots(), nil
+	case "ASKING":
+		c.asking = true
+		return "OK", nil
+	case "SCAN":
+		return c.scan(args...)
+	}
+	err := c.check(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	return c.Conn.Do(cmd, args...)
+}
+
+func (c *fakeNodeConn) Send(cmd string, args ...interface{}) error {
+	if strings.ToUpper(cmd) == "ASKING" {
+		c.asking = true
+		return c.Conn.Send("PING")
+	}
+	err := c.check(cmd, args)
+	if err != nil {
+		c.cluster.lock.Lock()
+		c.cluster.misrouted++
+		c.cluster.lock.Unlock()
+		//Let redis reply the redirect error in pipeline.
+		return c.Conn.Send("EVAL", "return redis.error_reply(ARGV[1])", 0, err.Error())
+	}
+	return c.Conn.Send(cmd, args...)
+}
+
+//scan only return keys owned by node,as all nodes share same redis server.
+func (c *fakeNodeConn) scan(args ...interface{}) (interface{}, error) {
+	values, err := redis.Values(c.Conn.Do("SCAN", args...))
+	if err != nil {
+		return nil, err
+	}
+	keys, err := redis.Strings(values[1], nil)
+	if err != nil {
+		return nil, err
+	}
+	result := []interface{}{}
+	c.cluster.lock.Lock()
+	defer c.cluster.lock.Unlock()
+	for _, v := range keys {
+		if c.cluster.owner[Slot(v)] == c.node {
+			result = append(result, []byte(v))
+		}
+	}
+	return []interface{}{values[0], result}, nil
+}
+
+func newTestClusterDriver() (*Driver, *fakeCluster) {
+	c := &Config{}
+	err := json.Unmarshal([]byte(testConfig), c)
+	if err != nil {
+		panic(err)
+	}
+	d, err := c.CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	driver := d.(*Driver)
+	conn := driver.Pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("FLUSHDB")
+	if err != nil {
+		panic(err)
+	}
+	fake := newFakeCluster(driver.Pool)
+	driver.Pool = nil
+	driver.Cluster = NewCluster([]string{"127.0.0.1:7001"}, fake.newPool)
+	return driver, fake
+}
+
+func TestSlot(t *testing.T) {
+	if Slot("123456789") != 12739 {
+		t.Fatal(Slot("123456789"))
+	}
+	if Slot("foo") != 12182 {
+		t.Fatal(Slot("foo"))
+	}
+	if Slot("{user1000}.following") != Slot("user1000") || Slot("{user1000}.followers") != Slot("user1000") {
+		t.Fatal(Slot("{user1000}.following"))
+	}
+	if Slot("foo{}{bar}") != int(crc16("foo{}{bar}")%ClusterSlots) {
+		t.Fatal(Slot("foo{}{bar}"))
+	}
+	if Slot("foo{{bar}}zap") != Slot("{bar") {
+		t.Fatal(Slot("foo{{bar}}zap"))
+	}
+	d := &Driver{Prefix: "{tenant}"}
+	if Slot(d.getKey([]byte("a"))) != Slot(d.getCounterKey([]byte("b"))) {
+		t.Fatal(d.getKey([]byte("a")))
+	}
+}
+
+func TestParseRedirect(t *testing.T) {
+	redirect, slot, addr, ok := parseRedirect(redis.Error("MOVED 3999 127.0.0.1:6381"))
+	if !ok || redirect != "MOVED" || slot != 3999 || addr != "127.0.0.1:6381" {
+		t.Fatal(redirect, slot, addr, ok)
+	}
+	redirect, slot, addr, ok = parseRedirect(redis.Error("ASK 3999 127.0.0.1:6381"))
+	if !ok || redirect != "ASK" || slot != 3999 || addr != "127.0.0.1:6381" {
+		t.Fatal(redirect, slot, addr, ok)
+	}
+	_, _, _, ok = parseRedirect(redis.Error("ERR unknown command"))
+	if ok {
+		t.Fatal(ok)
+	}
+	_, _, _, ok = parseRedirect(nil)
+	if ok {
+		t.Fatal(ok)
+	}
+}
+
+func TestClusterDriver(t *testing.T) {
+	var fake *fakeCluster
+	featuretestutil.TestDriver(func() kvdb.Driver {
+		var d *Driver
+		d, fake = newTestClusterDriver()
+		return d
+	},
+		func(args ...interface{}) { fmt.Println(args...); panic("fatal") })
+	if fake.misrouted != 0 {
+		t.Fatal(fake.misrouted)
+	}
+}
+
+func TestClusterRedirect(t *testing.T) {
+	d, fake := newTestClusterDriver()
+	defer d.Close()
+	var key []byte
+	for i := 0; ; i++ {
+		key = []byte(strconv.Itoa(i))
+		if Slot(d.getKey(key)) < ClusterSlots/2 && Slot(d.getCounterKey(key)) < ClusterSlots/2 {
+			break
+		}
+	}
+	err := d.Set(key, []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.lock.Lock()
+	fake.owner[Slot(d.getKey(key))] = "127.0.0.1:7002"
+	fake.lock.Unlock()
+	data, err := d.Get(key)
+	if err != nil || string(data) != "value" {
+		t.Fatal(string(data), err)
+	}
+	if fake.moved != 1 {
+		t.Fatal(fake.moved)
+	}
+	data, err = d.Get(key)
+	if err != nil || string(data) != "value" {
+		t.Fatal(string(data), err)
+	}
+	if fake.moved != 1 {
+		t.Fatal(fake.moved)
+	}
+	fake.lock.Lock()
+	fake.asking[Slot(d.getCounterKey(key))] = "127.0.0.1:7002"
+	fake.lock.Unlock()
+	v, err := d.IncreaseCounter(key, 2)
+	if err != nil || v != 2 {
+		t.Fatal(v, err)
+	}
+	if fake.asked != 1 {
+		t.Fatal(fake.asked)
+	}
+	fake.lock.Lock()
+	fake.owner[Slot(d.getCounterKey(key))] = "127.0.0.1:7002"
+	delete(fake.asking, Slot(d.getCounterKey(key)))
+	fake.lock.Unlock()
+	d.Cluster.Refresh()
+	v, err = d.IncreaseCounterWithTTL(key, 3, 3600)
+	if err != nil || v != 5 {
+		t.Fatal(v, err)
+	}
+	if fake.misrouted != 0 {
+		t.Fatal(fake.misrouted)
+	}
+}
+
+func TestClusterRefreshError(t *testing.T) {
+	dialerr := errors.New("dial error")
+	d := new()
+	d.Cluster = NewCluster([]string{"127.0.0.1:7001"}, func(addr string) *redis.Pool {
+		return &redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				return nil, dialerr
+			},
+		}
+	})
+	defer d.Close()
+	err := d.Set([]byte("key"), []byte("value"))
+	if err != dialerr {
+		t.Fatal(err)
+	}
+	err = d.SetMulti([]*herbdata.KeyValue{{Key: []byte("key"), Value: []byte("value")}})
+	if err != dialerr {
+		t.Fatal(err)
+	}
+	c := &Config{}
+	err = json.Unmarshal([]byte(testConfig), c)
+	if err != nil {
+		panic(err)
+	}
+	c.Cluster = true
+	c.Db = 1
+	_, err = c.CreateDriver()
+	if err != ErrClusterDb {
+		t.Fatal(err)
+	}
+}
+
+func TestClusterNext(t *testing.T) {
+	d, _ := newTestClusterDriver()
+	defer d.Close()
+	for i := 0; i < 50; i++ {
+		err := d.Set([]byte(strconv.Itoa(i)), []byte(strconv.Itoa(i)))
+		if err != nil {
+			panic(err)
+		}
+	}
+	masters, err := d.Cluster.Masters()
+	if err != nil || len(masters) != 2 {
+		t.Fatal(masters, err)
+	}
+	for _, limit := range []int{1, 7, 100} {
+		result := map[string]string{}
+		var iter []byte
+		var data []*herbdata.KeyValue
+		for {
+			data, iter, err = d.Next(iter, limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) > limit {
+				t.Fatal(len(data), limit)
+			}
+			for _, v := range data {
+				if result[string(v.Key)] != "" {
+					t.Fatal(string(v.Key))
+				}
+				result[string(v.Key)] = string(v.Value)
+			}
+			if len(iter) == 0 {
+				break
+			}
+		}
+		if len(result) != 50 {
+			t.Fatal(limit, len(result))
+		}
+		for k, v := range result {
+			if k != v {
+				t.Fatal(k, v)
+			}
+		}
+	}
+	_, _, err = d.Next(redisscan.EncodeIter("0", nil, "127.0.0.1:7003"), 1)
+	if err != ErrInvalidIter {
+		t.Fatal(err)
+	}
+}
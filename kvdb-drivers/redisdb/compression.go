@@ -0,0 +1,150 @@
+package redisdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+//CompressionNone store values uncompressed but still decode compressed values.
+//Useful when rolling back compression.
+const CompressionNone = "none"
+
+//CompressionSnappy compress values with snappy
+const CompressionSnappy = "snappy"
+
+//CompressionZstd compress values with zstd
+const CompressionZstd = "zstd"
+
+//CompressionGzip compress values with gzip
+const CompressionGzip = "gzip"
+
+//compressionHeader magic bytes prefixed to values encoded by compressor,
+//followed by one byte of compression id.
+var compressionHeader = []byte{0xff, 'h', 'c'}
+
+var compressionIDs = map[string]byte{
+	CompressionNone:   0,
+	CompressionSnappy: 1,
+	CompressionZstd:   2,
+	CompressionGzip:   3,
+}
+
+//ErrUnknownCompression error raised if compression or compression id is unknown.
+var ErrUnknownCompression = errors.New("redisdb: unknown compression")
+
+var zstdEncoder, _ = zstd.NewWriter(nil)
+var zstdDecoder, _ = zstd.NewReader(nil)
+
+//Compressor value compressor.
+//Compressed values are prefixed with a header,so values without header are returned as they are,
+//and compressed and uncompressed values can coexist.
+type Compressor struct {
+	//Compression compression used to encode values.
+	Compression string
+	//MinSize values shorter than MinSize will not be compressed.
+	MinSize int
+	id      byte
+}
+
+//NewCompressor create new compressor with given compression.
+//Return compressor and any error if raised.
+func NewCompressor(compression string) (*Compressor, error) {
+	id, ok := compressionIDs[compression]
+	if !ok {
+		return nil, ErrUnknownCompression
+	}
+	return &Compressor{
+		Compression: compression,
+		id:          id,
+	}, nil
+}
+
+func hasCompressionHeader(data []byte) bool {
+	return len(data) > len(compressionHeader) && bytes.HasPrefix(data, compressionHeader)
+}
+
+//Encode encode given value.
+//Return encoded value and any error if raised.
+func (c *Compressor) Encode(value []byte) ([]byte, error) {
+	if c.id == 0 || len(value) < c.MinSize {
+		//value looks like an encoded one should be wrapped to be decoded correctly
+		if hasCompressionHeader(value) {
+			return c.wrap(0, value), nil
+		}
+		return value, nil
+	}
+	var data []byte
+	switch c.id {
+	case 1:
+		data = snappy.Encode(nil, value)
+	case 2:
+		data = zstdEncoder.EncodeAll(value, nil)
+	case 3:
+		buf := bytes.NewBuffer(nil)
+		w := gzip.NewWriter(buf)
+		_, err := w.Write(value)
+		if err != nil {
+			return nil, err
+		}
+		err = w.Close()
+		if err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
+	}
+	return c.wrap(c.id, data), nil
+}
+
+func (c *Compressor) wrap(id byte, data []byte) []byte {
+	result := make([]byte, 0, len(compressionHeader)+1+len(data))
+	result = append(result, compressionHeader...)
+	result = append(result, id)
+	return append(result, data...)
+}
+
+//Decode decode given value.
+//Value without header will be returned as it is.
+//Return decoded value and any error if raised.
+func (c *Compressor) Decode(value []byte) ([]byte, error) {
+	if !hasCompressionHeader(value) {
+		return value, nil
+	}
+	data := value[len(compressionHeader)+1:]
+	switch value[len(compressionHeader)] {
+	case 0:
+		return data, nil
+	case 1:
+		return snappy.Decode(nil, data)
+	case 2:
+		return zstdDecoder.DecodeAll(data, nil)
+	case 3:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return nil, ErrUnknownCompression
+}
+
+//encode encode value with driver compressor.
+func (d *Driver) encode(value []byte) ([]byte, error) {
+	if d.Compressor == nil {
+		return value, nil
+	}
+	return d.Compressor.Encode(value)
+}
+
+//decode decode value with driver compressor.
+func (d *Driver) decode(value []byte) ([]byte, error) {
+	if d.Compressor == nil || value == nil {
+		return value, nil
+	}
+	return d.Compressor.Decode(value)
+}
@@ -0,0 +1,176 @@
+package redisdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/herb-go/herbdata"
+	"github.com/herb-go/herbdata/kvdb"
+	"github.com/herb-go/herbdata/kvdb/featuretestutil"
+)
+
+func newTestCompressionDriver(prefix string, compression string) *Driver {
+	c := &Config{}
+	err := json.Unmarshal([]byte(testConfig), c)
+	if err != nil {
+		panic(err)
+	}
+	c.Prefix = prefix
+	c.Compression = compression
+	d, err := c.CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	return d.(*Driver)
+}
+
+func TestCompressionDriver(t *testing.T) {
+	for _, v := range []string{CompressionSnappy, CompressionZstd, CompressionGzip, CompressionNone} {
+		compression := v
+		featuretestutil.TestDriver(func() kvdb.Driver {
+			d := newTestCompressionDriver("", compression)
+			conn := d.Pool.Get()
+			defer conn.Close()
+			conn.Send("FLUSHDB")
+			return d
+		},
+			func(args ...interface{}) { fmt.Println(compression); fmt.Println(args...); panic("fatal") })
+	}
+}
+
+func TestCompressor(t *testing.T) {
+	_, err := NewCompressor("unknown")
+	if err != ErrUnknownCompression {
+		t.Fatal(err)
+	}
+	value := bytes.Repeat([]byte("{\"field\":\"value\"}"), 100)
+	header := append([]byte{}, compressionHeader...)
+	for _, v := range []string{CompressionSnappy, CompressionZstd, CompressionGzip} {
+		c, err := NewCompressor(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := c.Encode(value)
+		if err != nil || !bytes.HasPrefix(data, header) || len(data) >= len(value) {
+			t.Fatal(v, len(data), err)
+		}
+		decoded, err := c.Decode(data)
+		if err != nil || !bytes.Equal(decoded, value) {
+			t.Fatal(v, err)
+		}
+		c.MinSize = len(value) + 1
+		data, err = c.Encode(value)
+		if err != nil || !bytes.Equal(data, value) {
+			t.Fatal(v, err)
+		}
+		decoded, err = c.Decode(data)
+		if err != nil || !bytes.Equal(decoded, value) {
+			t.Fatal(v, err)
+		}
+	}
+	c, err := NewCompressor(CompressionNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.Encode(value)
+	if err != nil || !bytes.Equal(data, value) {
+		t.Fatal(err)
+	}
+	//value which looks like compressed one should be wrapped
+	raw := append(append([]byte{}, compressionHeader...), 1, 2, 3)
+	data, err = c.Encode(raw)
+	if err != nil || bytes.Equal(data, raw) {
+		t.Fatal(data, err)
+	}
+	decoded, err := c.Decode(data)
+	if err != nil || !bytes.Equal(decoded, raw) {
+		t.Fatal(decoded, err)
+	}
+	_, err = c.Decode(append(append([]byte{}, compressionHeader...), 255, 1))
+	if err != ErrUnknownCompression {
+		t.Fatal(err)
+	}
+	decoded, err = c.Decode([]byte{})
+	if err != nil || len(decoded) != 0 {
+		t.Fatal(decoded, err)
+	}
+}
+
+func TestCompressionRollout(t *testing.T) {
+	value := bytes.Repeat([]byte("{\"field\":\"value\"}"), 100)
+	plain := newTestDriver("compression")
+	defer plain.Close()
+	conn := plain.Pool.Get()
+	_, err := conn.Do("FLUSHDB")
+	conn.Close()
+	if err != nil {
+		panic(err)
+	}
+	err = plain.Set([]byte("plain"), value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newTestCompressionDriver("compression", CompressionZstd)
+	defer d.Close()
+	data, err := d.Get([]byte("plain"))
+	if err != nil || !bytes.Equal(data, value) {
+		t.Fatal(err)
+	}
+	err = d.Set([]byte("compressed"), value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := d.Insert([]byte("inserted"), value)
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	ok, err = d.Update([]byte("plain"), value)
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	conn = d.Pool.Get()
+	defer conn.Close()
+	for _, v := range []string{"compressed", "inserted", "plain"} {
+		raw, err := redis.Bytes(conn.Do("GET", d.getKey([]byte(v))))
+		if err != nil || !bytes.HasPrefix(raw, compressionHeader) || len(raw) >= len(value) {
+			t.Fatal(v, len(raw), err)
+		}
+	}
+	_, err = d.IncreaseCounter([]byte("counter"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter, err := redis.Int64(conn.Do("GET", d.getCounterKey([]byte("counter"))))
+	if err != nil || counter != 10 {
+		t.Fatal(counter, err)
+	}
+	values, errs, err := d.GetMulti([][]byte{[]byte("compressed"), []byte("notfound")})
+	if err != nil || !bytes.Equal(values[0], value) || errs[0] != nil || errs[1] != herbdata.ErrNotFound {
+		t.Fatal(errs, err)
+	}
+	result, _, err := d.Next(nil, 10)
+	if err != nil || len(result) != 3 {
+		t.Fatal(result, err)
+	}
+	for _, v := range result {
+		if !bytes.Equal(v.Value, value) {
+			t.Fatal(string(v.Key))
+		}
+	}
+	//rolled back driver should still decode compressed values
+	rollback := newTestCompressionDriver("compression", CompressionNone)
+	defer rollback.Close()
+	data, err = rollback.Get([]byte("compressed"))
+	if err != nil || !bytes.Equal(data, value) {
+		t.Fatal(err)
+	}
+	c := &Config{}
+	c.Compression = "unknown"
+	_, err = c.CreateDriver()
+	if err != ErrUnknownCompression {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,502 @@
+package redisdb
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/herb-go/herbdata"
+	"github.com/herb-go/herbdata-drivers/kvdb-drivers/internal/redisscan"
+	"github.com/herb-go/herbdata/kvdb"
+)
+
+//HashFeatures features supported by hash driver
+var HashFeatures = kvdb.FeatureStore |
+	kvdb.FeatureInsert |
+	kvdb.FeatureUpdate |
+	kvdb.FeatureCounter |
+	kvdb.FeatureNext
+
+//HashFieldTTLFeatures features supported by hash driver if HashFieldTTL is enabled
+var HashFieldTTLFeatures = HashFeatures |
+	kvdb.FeatureTTLStore |
+	kvdb.FeatureTTLInsert |
+	kvdb.FeatureTTLUpdate |
+	kvdb.FeatureTTLCounter
+
+//ErrInvalidNamespace error raised if hash namespace starts with kvdb.SuggestedDataPrefix or kvdb.SuggestedCounterPrefix,
+//which makes hash key conflict with keys written by Driver.
+var ErrInvalidNamespace = errors.New("redisdb: hash namespace should not start with data or counter prefix")
+
+func checkNamespace(namespace string) error {
+	if namespace != "" && (namespace[0] == kvdb.SuggestedDataPrefix || namespace[0] == kvdb.SuggestedCounterPrefix) {
+		return ErrInvalidNamespace
+	}
+	return nil
+}
+
+//HashDriver driver which stores all values and counters of namespace in one redis hash.
+//Hash key is driver Prefix followed by Namespace,
+//and fields are keys prefixed with kvdb.SuggestedDataPrefix or kvdb.SuggestedCounterPrefix.
+//Namespace should not start with either prefix byte,or ErrInvalidNamespace will be raised.
+//
+//Whole namespace can be deleted with Clear and sized with Len.
+//Redis hashes do not support ttl of fields until redis 7.4,
+//so ttl features are only available if FieldTTL is enabled and fields expire with HEXPIRE.
+//Values are compressed as Driver does,but long keys are never hashed.
+type HashDriver struct {
+	kvdb.Nop
+	//Driver driver which provides connections.
+	Driver *Driver
+	//Namespace namespace name.
+	Namespace string
+	//FieldTTL set ttl of fields with HEXPIRE on redis 7.4+.
+	//Set,Update and SetCounter remove ttl of fields with HPERSIST if enabled.
+	FieldTTL bool
+}
+
+//Features return supported features
+func (h *HashDriver) Features() kvdb.Feature {
+	if h.FieldTTL {
+		return HashFieldTTLFeatures
+	}
+	return HashFeatures
+}
+
+//WithNamespace return copy of driver using given namespace.
+//ErrInvalidNamespace will be returned if namespace starts with a prefix byte.
+func (h *HashDriver) WithNamespace(namespace string) (*HashDriver, error) {
+	err := checkNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	driver := *h
+	driver.Namespace = namespace
+	return &driver, nil
+}
+
+//SetErrorHandler set error handler of inner driver.
+func (h *HashDriver) SetErrorHandler(f func(error)) {
+	h.Driver.SetErrorHandler(f)
+}
+
+//Start start database
+func (h *HashDriver) Start() error {
+	err := checkNamespace(h.Namespace)
+	if err != nil {
+		return err
+	}
+	return h.Driver.Start()
+}
+
+//Close close database
+func (h *HashDriver) Close() error {
+	return h.Driver.Close()
+}
+
+func (h *HashDriver) getHashKey() string {
+	return h.Driver.Prefix + h.Namespace
+}
+
+func (h *HashDriver) getField(key []byte) string {
+	return string(kvdb.SuggestedDataPrefix) + string(key)
+}
+
+func (h *HashDriver) getCounterField(key []byte) string {
+	return string(kvdb.SuggestedCounterPrefix) + string(key)
+}
+
+//Clear delete all values and counters in namespace with one DEL command.
+func (h *HashDriver) Clear() error {
+	k := h.getHashKey()
+	conn := h.Driver.getConn(k)
+	defer conn.Close()
+	_, err := conn.Do("DEL", k)
+	return convertError(err)
+}
+
+//Len return count of values and counters in namespace.
+func (h *HashDriver) Len() (int64, error) {
+	k := h.getHashKey()
+	conn := h.Driver.getReadConn(k)
+	defer conn.Close()
+	l, err := redis.Int64(conn.Do("HLEN", k))
+	return l, convertError(err)
+}
+
+//Set set value by given key
+func (h *HashDriver) Set(key []byte, value []byte) error {
+	data, err := h.Driver.encode(value)
+	if err != nil {
+		return err
+	}
+	k := h.getHashKey()
+	conn := h.Driver.getConn(k)
+	defer conn.Close()
+	return convertError(h.set(conn, k, h.getField(key), data))
+}
+
+//set set field without ttl.
+//Ttl of field will be removed if FieldTTL is enabled,as Driver does with SET.
+func (h *HashDriver) set(conn redis.Conn, k string, field string, data interface{}) error {
+	if h.FieldTTL {
+		_, err := hashSetWithTTLScript.Do(conn, k, field, data, 0)
+		return err
+	}
+	_, err := conn.Do("HSET", k, field, data)
+	return err
+}
+
+//SetWithTTL set value by given key and ttl in second
+func (h *HashDriver) SetWithTTL(key []byte, value []byte, ttlInSecond int64) error {
+	if !h.FieldTTL {
+		return kvdb.ErrFeatureNotSupported
+	}
+	if ttlInSecond <= 0 {
+		return herbdata.ErrInvalidatedTTL
+	}
+	data, err := h.Driver.encode(value)
+	if err != nil {
+		return err
+	}
+	k := h.getHashKey()
+	conn := h.Driver.getConn(k)
+	defer conn.Close()
+	_, err = hashSetWithTTLScript.Do(conn, k, h.getField(key), data, ttlInSecond)
+	return convertError(err)
+}
+
+//Get get value by given key
+func (h *HashDriver) Get(key []byte) ([]byte, error) {
+	k := h.getHashKey()
+	conn := h.Driver.getReadConn(k)
+	defer conn.Close()
+	data, err := redis.Bytes(conn.Do("HGET", k, h.getField(key)))
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return h.Driver.decode(data)
+}
+
+//Delete delete value by given key
+func (h *HashDriver) Delete(key []byte) error {
+	k := h.getHashKey()
+	conn := h.Driver.getConn(k)
+	defer conn.Close()
+	_, err := conn.Do("HDEL", k, h.getField(key))
+	return convertError(err)
+}
+
+//Insert insert value with given key.
+//Insert will fail if data with given key exists.
+//Return if operation success and any error if raised
+func (h *HashDriver) Insert(key []byte, value []byte) (bool, error) {
+	data, err := h.Driver.encode(value)
+	if err != nil {
+		return false, err
+	}
+	k := h.getHashKey()
+	conn := h.Driver.getConn(k)
+	defer conn.Close()
+	ok, err := redis.Bool(conn.Do("HSETNX", k, h.getField(key), data))
+	return ok, convertError(err)
+}
+
+//InsertWithTTL insert value with given key and ttl in second.
+//Insert will fail if data with given key exists.
+//Return if operation success and any error if raised
+func (h *HashDriver) InsertWithTTL(key []byte, value []byte, ttlInSecond int64) (bool, error) {
+	if !h.FieldTTL {
+		return false, kvdb.ErrFeatureNotSupported
+	}
+	if ttlInSecond <= 0 {
+		return false, herbdata.ErrInvalidatedTTL
+	}
+	data, err := h.Driver.encode(value)
+	if err != nil {
+		return false, err
+	}
+	k := h.getHashKey()
+	conn := h.Driver.getConn(k)
+	defer conn.Close()
+	ok, err := redis.Bool(hashInsertWithTTLScript.Do(conn, k, h.getField(key), data, ttlInSecond))
+	return ok, convertError(err)
+}
+
+//Update update value with given key.
+//Update will fail if data with given key does nto exist.
+//Return if operation success and any error if raised
+func (h *HashDriver) Update(key []byte, value []byte) (bool, error) {
+	data, err := h.Driver.encode(value)
+	if err != nil {
+		return false, err
+	}
+	k := h.getHashKey()
+	conn := h.Driver.getConn(k)
+	defer conn.Close()
+	var ok bool
+	if h.FieldTTL {
+		//remove ttl of field as Driver does with SET XX
+		ok, err = redis.Bool(hashUpdateScript.Do(conn, k, h.getField(key), data, 0))
+	} else {
+		ok, err = redis.Bool(hashUpdateScript.Do(conn, k, h.getField(key), data))
+	}
+	return ok, convertError(err)
+}
+
+//UpdateWithTTL update value with given key and ttl in second.
+//Update will fail if data with given key does nto exist.
+//Return if operation success and any error if raised
+func (h *HashDriver) UpdateWithTTL(key []byte, value []byte, ttlInSecond int64) (bool, error) {
+	if !h.FieldTTL {
+		return false, kvdb.ErrFeatureNotSupported
+	}
+	if ttlInSecond <= 0 {
+		return false, herbdata.ErrInvalidatedTTL
+	}
+	data, err := h.Driver.encode(value)
+	if err != nil {
+		return false, err
+	}
+	k := h.getHashKey()
+	conn := h.Driver.getConn(k)
+	defer conn.Close()
+	ok, err := redis.Bool(hashUpdateScript.Do(conn, k, h.getField(key), data, ttlInSecond))
+	return ok, convertError(err)
+}
+
+//SetCounter set counter value with given key
+func (h *HashDriver) SetCounter(key []byte, value int64) error {
+	k := h.getHashKey()
+	conn := h.Driver.getConn(k)
+	defer conn.Close()
+	return convertError(h.set(conn, k, h.getCounterField(key), value))
+}
+
+//SetCounterWithTTL set counter value with given key and ttl in second
+func (h *HashDriver) SetCounterWithTTL(key []byte, value int64, ttlInSecond int64) error {
+	if !h.FieldTTL {
+		return kvdb.ErrFeatureNotSupported
+	}
+	if ttlInSecond <= 0 {
+		return herbdata.ErrInvalidatedTTL
+	}
+	k := h.getHashKey()
+	conn := h.Driver.getConn(k)
+	defer conn.Close()
+	_, err := hashSetWithTTLScript.Do(conn, k, h.getCounterField(key), value, ttlInSecond)
+	return convertError(err)
+}
+
+//IncreaseCounter increace counter value with given key and increasement.
+//Value not existed coutn as 0.
+//Return final value and any error if raised.
+func (h *HashDriver) IncreaseCounter(key []byte, incr int64) (int64, error) {
+	k := h.getHashKey()
+	conn := h.Driver.getConn(k)
+	defer conn.Close()
+	data, err := redis.Int64(conn.Do("HINCRBY", k, h.getCounterField(key), incr))
+	return data, convertError(err)
+}
+
+//IncreaseCounterWithTTL increace counter value with given key ,increasement,and ttl in second
+//Value not existed coutn as 0.
+//Return final value and any error if raised.
+func (h *HashDriver) IncreaseCounterWithTTL(key []byte, incr int64, ttlInSecond int64) (int64, error) {
+	if !h.FieldTTL {
+		return 0, kvdb.ErrFeatureNotSupported
+	}
+	if ttlInSecond <= 0 {
+		return 0, herbdata.ErrInvalidatedTTL
+	}
+	k := h.getHashKey()
+	conn := h.Driver.getConn(k)
+	defer conn.Close()
+	data, err := redis.Int64(hashIncreaseWithTTLScript.Do(conn, k, h.getCounterField(key), incr, ttlInSecond))
+	return data, convertError(err)
+}
+
+//GetCounter get counter value with given key
+//Value not existed coutn as 0.
+func (h *HashDriver) GetCounter(key []byte) (int64, error) {
+	k := h.getHashKey()
+	conn := h.Driver.getReadConn(k)
+	defer conn.Close()
+	data, err := redis.Int64(conn.Do("HGET", k, h.getCounterField(key)))
+	err = convertError(err)
+	if err == herbdata.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return data, nil
+}
+
+//DeleteCounter delete counter value with given key
+func (h *HashDriver) DeleteCounter(key []byte) error {
+	k := h.getHashKey()
+	conn := h.Driver.getConn(k)
+	defer conn.Close()
+	_, err := conn.Do("HDEL", k, h.getCounterField(key))
+	return convertError(err)
+}
+
+//Next return keys after iter not more than given limit
+//Empty iter (nil or 0 length []byte) will start a new search
+//Return keyvalue ,newiter and any error if raised.
+//Empty iter (nil or 0 length []byte) will be returned if no more keys
+//
+//Fields are walked with redis HSCAN command,so they are NOT returned in byte order.
+//Fields scanned but not returned because of limit are kept in newiter.
+//In sentinel mode fields are scanned on master even if ReadFromReplicas is enabled.
+func (h *HashDriver) Next(iter []byte, limit int) (result []*herbdata.KeyValue, newiter []byte, err error) {
+	if limit <= 0 {
+		return nil, nil, kvdb.ErrUnsupportedNextLimit
+	}
+	cursor, pending, node, err := redisscan.DecodeIter(iter)
+	if err != nil {
+		return nil, nil, err
+	}
+	if node != "" {
+		return nil, nil, ErrInvalidIter
+	}
+	prefix := h.getField(nil)
+	for _, v := range pending {
+		if !strings.HasPrefix(v, prefix) {
+			return nil, nil, ErrInvalidIter
+		}
+	}
+	k := h.getHashKey()
+	//HSCAN cursor is only valid on instance which issued it
+	conn := h.Driver.getConn(k)
+	defer conn.Close()
+	pattern := redisscan.EscapePattern(prefix) + "*"
+	for {
+		n := limit - len(result)
+		if n > len(pending) {
+			n = len(pending)
+		}
+		data, err := h.fetch(conn, pending[:n])
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, data...)
+		pending = pending[n:]
+		if len(pending) > 0 {
+			return result, redisscan.EncodeIter(cursor, pending, ""), nil
+		}
+		if cursor == "" {
+			return result, nil, nil
+		}
+		if len(result) >= limit {
+			return result, redisscan.EncodeIter(cursor, nil, ""), nil
+		}
+		var next string
+		var fields [][]byte
+		values, err := redis.Values(conn.Do("HSCAN", k, cursor, "MATCH", pattern, "COUNT", limit))
+		if err != nil {
+			return nil, nil, convertError(err)
+		}
+		_, err = redis.Scan(values, &next, &fields)
+		if err != nil {
+			return nil, nil, err
+		}
+		cursor = next
+		if cursor == "0" {
+			cursor = ""
+		}
+		//fields are returned as field value pairs
+		for i := 0; i+1 < len(fields); i += 2 {
+			if len(result) >= limit {
+				pending = append(pending, string(fields[i]))
+				continue
+			}
+			value, err := h.Driver.decode(fields[i+1])
+			if err != nil {
+				return nil, nil, err
+			}
+			result = append(result, &herbdata.KeyValue{
+				Key:   fields[i][len(prefix):],
+				Value: value,
+			})
+		}
+	}
+}
+
+//fetch load values of given fields with HMGET.
+//Fields expired or deleted after scanned will be skipped.
+func (h *HashDriver) fetch(conn redis.Conn, fields []string) ([]*herbdata.KeyValue, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, 0, len(fields)+1)
+	args = append(args, h.getHashKey())
+	for k := range fields {
+		args = append(args, fields[k])
+	}
+	values, err := redis.ByteSlices(conn.Do("HMGET", args...))
+	if err != nil {
+		return nil, convertError(err)
+	}
+	prefixlen := len(h.getField(nil))
+	result := make([]*herbdata.KeyValue, 0, len(fields))
+	for k := range fields {
+		if values[k] == nil {
+			continue
+		}
+		value, err := h.Driver.decode(values[k])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &herbdata.KeyValue{
+			Key:   []byte(fields[k][prefixlen:]),
+			Value: value,
+		})
+	}
+	return result, nil
+}
+
+//hashSetWithTTLScript script set field and set ttl of field,or remove ttl of field if ttl is 0.
+var hashSetWithTTLScript = redis.NewScript(1, `
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+if tonumber(ARGV[3]) > 0 then
+	redis.call('HEXPIRE', KEYS[1], ARGV[3], 'FIELDS', 1, ARGV[1])
+else
+	redis.call('HPERSIST', KEYS[1], 'FIELDS', 1, ARGV[1])
+end
+return 1
+`)
+
+//hashInsertWithTTLScript script set field and set ttl of field if field not exists.
+var hashInsertWithTTLScript = redis.NewScript(1, `
+if redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('HEXPIRE', KEYS[1], ARGV[3], 'FIELDS', 1, ARGV[1])
+return 1
+`)
+
+//hashUpdateScript script set field only if field exists.
+//Ttl of field will be set if ttl given,or removed if given ttl is 0.
+var hashUpdateScript = redis.NewScript(1, `
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+if #ARGV > 2 then
+	if tonumber(ARGV[3]) > 0 then
+		redis.call('HEXPIRE', KEYS[1], ARGV[3], 'FIELDS', 1, ARGV[1])
+	else
+		redis.call('HPERSIST', KEYS[1], 'FIELDS', 1, ARGV[1])
+	end
+end
+return 1
+`)
+
+//hashIncreaseWithTTLScript script increase field and set ttl of field.
+var hashIncreaseWithTTLScript = redis.NewScript(1, `
+local value = redis.call('HINCRBY', KEYS[1], ARGV[1], ARGV[2])
+redis.call('HEXPIRE', KEYS[1], ARGV[3], 'FIELDS', 1, ARGV[1])
+return value
+`)
@@ -0,0 +1,336 @@
+package redisdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/herb-go/herbdata"
+	"github.com/herb-go/herbdata-drivers/kvdb-drivers/internal/redisscan"
+	"github.com/herb-go/herbdata/kvdb"
+	"github.com/herb-go/herbdata/kvdb/featuretestutil"
+)
+
+func newTestHashDriver(config string, namespace string) *HashDriver {
+	c := &Config{}
+	err := json.Unmarshal([]byte(config), c)
+	if err != nil {
+		panic(err)
+	}
+	c.Prefix = "hash*["
+	c.Hash = true
+	c.HashNamespace = namespace
+	c.Compression = CompressionSnappy
+	d, err := c.CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	return d.(*HashDriver)
+}
+
+func TestHashDriver(t *testing.T) {
+	featuretestutil.TestDriver(func() kvdb.Driver {
+		d := newTestHashDriver(testConfig, "featuretest")
+		err := d.Clear()
+		if err != nil {
+			panic(err)
+		}
+		return d
+	},
+		func(args ...interface{}) { fmt.Println(args...); panic("fatal") })
+}
+
+func TestHashNamespace(t *testing.T) {
+	d := newTestHashDriver(testConfig, "ns1")
+	defer d.Close()
+	other, err := d.WithNamespace("ns2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Namespace != "ns1" || other.Namespace != "ns2" {
+		t.Fatal(d.Namespace, other.Namespace)
+	}
+	for _, v := range []*HashDriver{d, other} {
+		err = v.Clear()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = d.Set([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.SetCounter([]byte("key"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = other.Set([]byte("otherkey"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := d.Len()
+	if l != 2 || err != nil {
+		t.Fatal(l, err)
+	}
+	l, err = other.Len()
+	if l != 1 || err != nil {
+		t.Fatal(l, err)
+	}
+	_, err = other.Get([]byte("key"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	c, err := other.GetCounter([]byte("key"))
+	if c != 0 || err != nil {
+		t.Fatal(c, err)
+	}
+	conn := d.Driver.getConn("")
+	n, err := conn.Do("EXISTS", "hash*[ns1")
+	conn.Close()
+	if n != int64(1) || err != nil {
+		t.Fatal(n, err)
+	}
+	err = d.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err = d.Len()
+	if l != 0 || err != nil {
+		t.Fatal(l, err)
+	}
+	_, err = d.Get([]byte("key"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	l, err = other.Len()
+	if l != 1 || err != nil {
+		t.Fatal(l, err)
+	}
+}
+
+func TestHashInvalidNamespace(t *testing.T) {
+	d := newTestHashDriver(testConfig, "ns1")
+	defer d.Close()
+	for _, ns := range []string{"\x00ns", "\x01ns"} {
+		_, err := d.WithNamespace(ns)
+		if err != ErrInvalidNamespace {
+			t.Fatal(ns, err)
+		}
+		c := &Config{}
+		err = json.Unmarshal([]byte(testConfig), c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Hash = true
+		c.HashNamespace = ns
+		_, err = c.CreateDriver()
+		if err != ErrInvalidNamespace {
+			t.Fatal(ns, err)
+		}
+		invalid := *d
+		invalid.Namespace = ns
+		err = invalid.Start()
+		if err != ErrInvalidNamespace {
+			t.Fatal(ns, err)
+		}
+	}
+}
+
+func TestHashErrorHandler(t *testing.T) {
+	d := newTestHashDriver(testConfig, "ns1")
+	defer d.Close()
+	var got error
+	handler := func(err error) {
+		got = err
+	}
+	d.SetErrorHandler(handler)
+	if d.Driver.ErrHandler == nil {
+		t.Fatal("error handler not set")
+	}
+	d.Driver.ErrHandler(herbdata.ErrNotFound)
+	if got != herbdata.ErrNotFound {
+		t.Fatal(got)
+	}
+}
+
+func TestHashNext(t *testing.T) {
+	d := newTestHashDriver(testConfig, "next")
+	defer d.Close()
+	err := d.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{}
+	for i := 0; i < 25; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		expected = append(expected, key)
+		err = d.Set([]byte(key), []byte("value"+key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = d.IncreaseCounter([]byte(key), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = d.Set([]byte("a*"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = append(expected, "a*")
+	sort.Strings(expected)
+	keys := []string{}
+	var iter []byte
+	for {
+		var result []*herbdata.KeyValue
+		result, iter, err = d.Next(iter, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result) > 7 {
+			t.Fatal(len(result))
+		}
+		for _, v := range result {
+			if !bytes.Equal(v.Value, []byte("value"+string(v.Key))) && string(v.Key) != "a*" {
+				t.Fatal(string(v.Key), string(v.Value))
+			}
+			keys = append(keys, string(v.Key))
+		}
+		if len(iter) == 0 {
+			break
+		}
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != strings.Join(expected, ",") {
+		t.Fatal(keys)
+	}
+	_, _, err = d.Next(redisscan.EncodeIter("0", nil, "node"), 1)
+	if err != ErrInvalidIter {
+		t.Fatal(err)
+	}
+}
+
+func TestHashFieldTTL(t *testing.T) {
+	m := miniredis.RunT(t)
+	config := fmt.Sprintf(`{"Network":"tcp","Address":%q,"MaxIdle":10}`, m.Addr())
+	d := newTestHashDriver(config, "ttl")
+	defer d.Close()
+	if d.Features().SupportAll(kvdb.FeatureTTLStore) {
+		t.Fatal(d.Features())
+	}
+	err := d.SetWithTTL([]byte("key"), []byte("value"), 10)
+	if err != kvdb.ErrFeatureNotSupported {
+		t.Fatal(err)
+	}
+	_, err = d.IncreaseCounterWithTTL([]byte("key"), 1, 10)
+	if err != kvdb.ErrFeatureNotSupported {
+		t.Fatal(err)
+	}
+	d.FieldTTL = true
+	if !d.Features().SupportAll(kvdb.FeatureTTLStore | kvdb.FeatureTTLInsert | kvdb.FeatureTTLUpdate | kvdb.FeatureTTLCounter) {
+		t.Fatal(d.Features())
+	}
+	hashkey := "hash*[ttl"
+	field := string(kvdb.SuggestedDataPrefix) + "key"
+	counterfield := string(kvdb.SuggestedCounterPrefix) + "key"
+	expect := func(field string, ttl time.Duration) {
+		if v := m.HTTL(hashkey, field); v != ttl {
+			t.Fatal(field, v)
+		}
+	}
+	err = d.SetWithTTL([]byte("key"), []byte("value"), 0)
+	if err != herbdata.ErrInvalidatedTTL {
+		t.Fatal(err)
+	}
+	ok, err := d.UpdateWithTTL([]byte("key"), []byte("value"), 10)
+	if ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	ok, err = d.InsertWithTTL([]byte("key"), []byte("value"), 10)
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	expect(field, 10*time.Second)
+	ok, err = d.InsertWithTTL([]byte("key"), []byte("value"), 10)
+	if ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	ok, err = d.UpdateWithTTL([]byte("key"), []byte("newvalue"), 20)
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	expect(field, 20*time.Second)
+	err = d.SetWithTTL([]byte("key"), []byte("value"), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(field, 30*time.Second)
+	data, err := d.Get([]byte("key"))
+	if string(data) != "value" || err != nil {
+		t.Fatal(string(data), err)
+	}
+	m.FastForward(29 * time.Second)
+	data, err = d.Get([]byte("key"))
+	if string(data) != "value" || err != nil {
+		t.Fatal(string(data), err)
+	}
+	m.FastForward(time.Second)
+	_, err = d.Get([]byte("key"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	//update without ttl removes ttl of field
+	err = d.SetWithTTL([]byte("key"), []byte("value"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err = d.Update([]byte("key"), []byte("updated"))
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	expect(field, 0)
+	m.FastForward(time.Minute)
+	data, err = d.Get([]byte("key"))
+	if string(data) != "updated" || err != nil {
+		t.Fatal(string(data), err)
+	}
+	//set without ttl removes ttl of field
+	err = d.SetWithTTL([]byte("key"), []byte("value"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Set([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(field, 0)
+	err = d.SetCounterWithTTL([]byte("key"), 5, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(counterfield, 40*time.Second)
+	v, err := d.IncreaseCounterWithTTL([]byte("key"), 2, 50)
+	if v != 7 || err != nil {
+		t.Fatal(v, err)
+	}
+	expect(counterfield, 50*time.Second)
+	m.FastForward(50 * time.Second)
+	v, err = d.GetCounter([]byte("key"))
+	if v != 0 || err != nil {
+		t.Fatal(v, err)
+	}
+	err = d.SetCounterWithTTL([]byte("key"), 5, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.SetCounter([]byte("key"), 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(counterfield, 0)
+}
@@ -0,0 +1,99 @@
+package redisdb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+)
+
+//hashedKeyMarker marker prefixed to hex encoded sha256 sum of hashed keys.
+//Keys start with marker are always hashed if MaxKeyLength is not 0,so they will never conflict with hashed keys.
+//Keys are stored as they are if MaxKeyLength is 0,including keys start with marker.
+const hashedKeyMarker = "\xffsha256:"
+
+//originalKeyHeader magic bytes prefixed to values of hashed keys,
+//followed by uvarint encoded length of original key and original key.
+var originalKeyHeader = []byte{0xff, 'h', 'k'}
+
+//hashKey return key used in redis for given key.
+//Key longer than MaxKeyLength will be hashed with sha256.
+func (d *Driver) hashKey(key []byte) string {
+	if !d.isHashed(key) {
+		return string(key)
+	}
+	sum := sha256.Sum256(key)
+	return hashedKeyMarker + hex.EncodeToString(sum[:])
+}
+
+func (d *Driver) isHashed(key []byte) bool {
+	if d.MaxKeyLength <= 0 {
+		return false
+	}
+	return len(key) > d.MaxKeyLength || bytes.HasPrefix(key, []byte(hashedKeyMarker))
+}
+
+//isHashedRedisKey check if given redis key without prefix is a hashed key.
+func (d *Driver) isHashedRedisKey(key string) bool {
+	if d.MaxKeyLength <= 0 {
+		return false
+	}
+	return len(key) == len(hashedKeyMarker)+sha256.Size*2 && strings.HasPrefix(key, hashedKeyMarker)
+}
+
+//encodeValue encode value stored with given key.
+//Original key will be stored before value if key is hashed and StoreOriginalKey is true.
+func (d *Driver) encodeValue(key []byte, value []byte) ([]byte, error) {
+	data, err := d.encode(value)
+	if err != nil {
+		return nil, err
+	}
+	if !d.isHashed(key) {
+		return data, nil
+	}
+	if d.StoreOriginalKey {
+		return wrapOriginalKey(key, data), nil
+	}
+	//value looks like a wrapped one should be wrapped to be decoded correctly
+	if bytes.HasPrefix(data, originalKeyHeader) {
+		return wrapOriginalKey(nil, data), nil
+	}
+	return data, nil
+}
+
+//decodeValue decode value stored with given key.
+func (d *Driver) decodeValue(key []byte, data []byte) ([]byte, error) {
+	if d.isHashed(key) {
+		_, data = unwrapOriginalKey(data)
+	}
+	return d.decode(data)
+}
+
+func wrapOriginalKey(key []byte, data []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(len(key)))
+	result := make([]byte, 0, len(originalKeyHeader)+n+len(key)+len(data))
+	result = append(result, originalKeyHeader...)
+	result = append(result, buf[:n]...)
+	result = append(result, key...)
+	return append(result, data...)
+}
+
+//unwrapOriginalKey split original key and value from given data.
+//Key will be nil if original key not stored.
+func unwrapOriginalKey(data []byte) (key []byte, value []byte) {
+	if !bytes.HasPrefix(data, originalKeyHeader) {
+		return nil, data
+	}
+	l, n := binary.Uvarint(data[len(originalKeyHeader):])
+	start := len(originalKeyHeader) + n
+	if n <= 0 || uint64(len(data)-start) < l {
+		return nil, data
+	}
+	end := start + int(l)
+	if l == 0 {
+		return nil, data[end:]
+	}
+	return data[start:end], data[end:]
+}
@@ -0,0 +1,150 @@
+package redisdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/herb-go/herbdata/kvdb"
+	"github.com/herb-go/herbdata/kvdb/featuretestutil"
+)
+
+func newTestHashKeyDriver(prefix string, storeOriginalKey bool) *Driver {
+	c := &Config{}
+	err := json.Unmarshal([]byte(testConfig), c)
+	if err != nil {
+		panic(err)
+	}
+	c.Prefix = prefix
+	c.MaxKeyLength = 4
+	c.StoreOriginalKey = storeOriginalKey
+	c.Compression = CompressionSnappy
+	d, err := c.CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	return d.(*Driver)
+}
+
+func TestHashKeyDriver(t *testing.T) {
+	featuretestutil.TestDriver(func() kvdb.Driver {
+		d := newTestHashKeyDriver("", true)
+		conn := d.Pool.Get()
+		defer conn.Close()
+		conn.Send("FLUSHDB")
+		return d
+	},
+		func(args ...interface{}) { fmt.Println(args...); panic("fatal") })
+}
+
+func TestHashKey(t *testing.T) {
+	longkey := []byte(strings.Repeat("longkey", 100))
+	markerkey := []byte(hashedKeyMarker)
+	headervalue := append(append([]byte{}, originalKeyHeader...), 1, 'k', 'v')
+	for _, storeOriginalKey := range []bool{true, false} {
+		d := newTestHashKeyDriver("hashkey", storeOriginalKey)
+		conn := d.Pool.Get()
+		_, err := conn.Do("FLUSHDB")
+		if err != nil {
+			panic(err)
+		}
+		if d.getKey([]byte("key")) != "hashkey"+string(kvdb.SuggestedDataPrefix)+"key" {
+			t.Fatal(d.getKey([]byte("key")))
+		}
+		if len(d.getKey(longkey)) != len("hashkey")+len(string(kvdb.SuggestedDataPrefix))+len(hashedKeyMarker)+64 {
+			t.Fatal(d.getKey(longkey))
+		}
+		if d.getKey(markerkey) == "hashkey"+string(kvdb.SuggestedDataPrefix)+string(markerkey) {
+			t.Fatal(d.getKey(markerkey))
+		}
+		for _, v := range [][]byte{[]byte("key"), longkey, markerkey} {
+			err = d.Set(v, headervalue)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := d.Get(v)
+			if err != nil || !bytes.Equal(data, headervalue) {
+				t.Fatal(storeOriginalKey, string(v), data, err)
+			}
+		}
+		_, err = d.IncreaseCounter(longkey, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counter, err := redis.Int64(conn.Do("GET", d.getCounterKey(longkey)))
+		if err != nil || counter != 1 || len(d.getCounterKey(longkey)) > 100 {
+			t.Fatal(counter, err)
+		}
+		values, errs, err := d.GetMulti([][]byte{longkey, []byte("key")})
+		if err != nil || errs[0] != nil || errs[1] != nil || !bytes.Equal(values[0], headervalue) || !bytes.Equal(values[1], headervalue) {
+			t.Fatal(values, errs, err)
+		}
+		result, _, err := d.Next(nil, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := map[string]bool{}
+		for _, v := range result {
+			if !bytes.Equal(v.Value, headervalue) {
+				t.Fatal(string(v.Key), v.Value)
+			}
+			keys[string(v.Key)] = true
+		}
+		if storeOriginalKey {
+			if len(keys) != 3 || !keys["key"] || !keys[string(longkey)] || !keys[string(markerkey)] {
+				t.Fatal(keys)
+			}
+		} else {
+			if len(keys) != 1 || !keys["key"] {
+				t.Fatal(keys)
+			}
+		}
+		conn.Close()
+		d.Close()
+	}
+}
+
+func TestMarkerKeyWithoutHashing(t *testing.T) {
+	d := newTestHashKeyDriver("markerkey", true)
+	defer d.Close()
+	d.MaxKeyLength = 0
+	conn := d.Pool.Get()
+	_, err := conn.Do("FLUSHDB")
+	conn.Close()
+	if err != nil {
+		panic(err)
+	}
+	markerkey := []byte(hashedKeyMarker + strings.Repeat("0", 64))
+	err = d.Set(markerkey, []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.getKey(markerkey) != "markerkey"+string(kvdb.SuggestedDataPrefix)+string(markerkey) {
+		t.Fatal(d.getKey(markerkey))
+	}
+	result, _, err := d.Next(nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || !bytes.Equal(result[0].Key, markerkey) || string(result[0].Value) != "value" {
+		t.Fatal(result)
+	}
+}
+
+func TestOriginalKey(t *testing.T) {
+	for _, v := range [][]byte{nil, []byte("key"), []byte(strings.Repeat("k", 1000))} {
+		key, value := unwrapOriginalKey(wrapOriginalKey(v, []byte("value")))
+		if !bytes.Equal(key, v) || string(value) != "value" {
+			t.Fatal(key, value)
+		}
+	}
+	//broken header should be returned as it is
+	data := append(append([]byte{}, originalKeyHeader...), 10, 'k')
+	key, value := unwrapOriginalKey(data)
+	if key != nil || !bytes.Equal(value, data) {
+		t.Fatal(key, value)
+	}
+}
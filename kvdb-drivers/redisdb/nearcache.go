@@ -0,0 +1,261 @@
+package redisdb
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//ErrNearCacheWithCluster error raised if near cache is enabled in cluster mode
+var ErrNearCacheWithCluster = errors.New("redisdb: near cache can not be used in cluster mode")
+
+//ErrNearCacheWithReplicas error raised if near cache is enabled with reading from replicas
+var ErrNearCacheWithReplicas = errors.New("redisdb: near cache can not be used with reading from replicas")
+
+//DefaultNearCacheRetryInterval default interval to wait before resubscribing invalidation messages
+var DefaultNearCacheRetryInterval = time.Second
+
+//invalidateChannel channel which redis sends tracking invalidation messages to with RESP2
+const invalidateChannel = "__redis__:invalidate"
+
+//NearCacheStats near cache statistics
+type NearCacheStats struct {
+	//Hits count of Get served by near cache.
+	Hits uint64
+	//Misses count of Get sent to redis.
+	Misses uint64
+	//Entries count of values in near cache.
+	Entries int
+}
+
+type nearCacheEntry struct {
+	key   string
+	value []byte
+}
+
+//NearCache bounded local LRU cache of values,invalidated by redis CLIENT TRACKING in broadcast mode.
+//Values are only cached while invalidation messages are being received,
+//and cache will be flushed when invalidation connection is lost.
+type NearCache struct {
+	//Size max count of values in cache.
+	Size int
+	//RetryInterval interval to wait before resubscribing after connection lost.
+	RetryInterval time.Duration
+	lock          sync.Mutex
+	list          *list.List
+	entries       map[string]*list.Element
+	tracking      bool
+	//seq increased on every invalidation,
+	//values fetched before invalidation will not be cached.
+	seq        uint64
+	hits       uint64
+	misses     uint64
+	stopped    chan struct{}
+	conn       redis.Conn
+	wg         sync.WaitGroup
+	errhandler func(error)
+}
+
+//NewNearCache create new near cache with given size.
+func NewNearCache(size int) *NearCache {
+	return &NearCache{
+		Size:          size,
+		RetryInterval: DefaultNearCacheRetryInterval,
+		list:          list.New(),
+		entries:       map[string]*list.Element{},
+	}
+}
+
+//Stats return near cache statistics.
+func (c *NearCache) Stats() NearCacheStats {
+	c.lock.Lock()
+	entries := c.list.Len()
+	c.lock.Unlock()
+	return NearCacheStats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Entries: entries,
+	}
+}
+
+//get get cached value of given redis key.
+//Return value,current invalidation seq and if value is found.
+func (c *NearCache) get(key string) ([]byte, uint64, bool) {
+	c.lock.Lock()
+	e, ok := c.entries[key]
+	if !ok {
+		seq := c.seq
+		c.lock.Unlock()
+		atomic.AddUint64(&c.misses, 1)
+		return nil, seq, false
+	}
+	c.list.MoveToFront(e)
+	value := append([]byte{}, e.Value.(*nearCacheEntry).value...)
+	c.lock.Unlock()
+	atomic.AddUint64(&c.hits, 1)
+	return value, 0, true
+}
+
+//set cache value of given redis key.
+//Value will be dropped if tracking is off or any invalidation happened after seq.
+func (c *NearCache) set(key string, value []byte, seq uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.tracking || seq != c.seq || c.Size <= 0 {
+		return
+	}
+	value = append([]byte{}, value...)
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*nearCacheEntry).value = value
+		c.list.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.list.PushFront(&nearCacheEntry{key: key, value: value})
+	for c.list.Len() > c.Size {
+		e := c.list.Back()
+		c.list.Remove(e)
+		delete(c.entries, e.Value.(*nearCacheEntry).key)
+	}
+}
+
+//invalidate remove values of given redis keys.
+func (c *NearCache) invalidate(keys ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.seq++
+	for _, key := range keys {
+		if e, ok := c.entries[key]; ok {
+			c.list.Remove(e)
+			delete(c.entries, key)
+		}
+	}
+}
+
+//setTracking flush cache and set if invalidation messages are being received.
+func (c *NearCache) setTracking(tracking bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.seq++
+	c.tracking = tracking
+	c.list.Init()
+	c.entries = map[string]*list.Element{}
+}
+
+//start start tracking keys with given prefix with connections created by given dial function.
+//Connections should not be managed by pool,as tracking is stopped by closing connection.
+func (c *NearCache) start(dial func() redis.Conn, prefix string, errhandler func(error)) {
+	c.lock.Lock()
+	c.stopped = make(chan struct{})
+	c.errhandler = errhandler
+	c.lock.Unlock()
+	c.wg.Add(1)
+	go c.watch(dial, prefix)
+}
+
+//stop stop tracking and flush cache.
+func (c *NearCache) stop() {
+	c.lock.Lock()
+	if c.stopped == nil {
+		c.lock.Unlock()
+		return
+	}
+	select {
+	case <-c.stopped:
+		c.lock.Unlock()
+		return
+	default:
+	}
+	close(c.stopped)
+	if c.conn != nil {
+		//closing connection unblocks receiving loop even if server never replies
+		c.conn.Close()
+	}
+	c.lock.Unlock()
+	c.wg.Wait()
+}
+
+func (c *NearCache) watch(dial func() redis.Conn, prefix string) {
+	defer c.wg.Done()
+	for {
+		err := c.receive(dial, prefix)
+		c.setTracking(false)
+		select {
+		case <-c.stopped:
+			return
+		default:
+		}
+		if err != nil {
+			c.errhandler(err)
+		}
+		select {
+		case <-c.stopped:
+			return
+		case <-time.After(c.RetryInterval):
+		}
+	}
+}
+
+func (c *NearCache) receive(dial func() redis.Conn, prefix string) error {
+	conn := dial()
+	defer conn.Close()
+	id, err := redis.Int64(conn.Do("CLIENT", "ID"))
+	if err != nil {
+		return err
+	}
+	//invalidation messages are redirected to connection itself as RESP2 push messages are not supported.
+	_, err = conn.Do("CLIENT", "TRACKING", "on", "REDIRECT", id, "BCAST", "PREFIX", prefix)
+	if err != nil {
+		return err
+	}
+	err = conn.Send("SUBSCRIBE", invalidateChannel)
+	if err != nil {
+		return err
+	}
+	err = conn.Flush()
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	select {
+	case <-c.stopped:
+		c.lock.Unlock()
+		return nil
+	default:
+	}
+	c.conn = conn
+	c.lock.Unlock()
+	defer func() {
+		c.lock.Lock()
+		c.conn = nil
+		c.lock.Unlock()
+	}()
+	for {
+		reply, err := redis.Values(redis.ReceiveWithTimeout(conn, 0))
+		if err != nil {
+			return err
+		}
+		if len(reply) < 3 {
+			continue
+		}
+		kind, _ := redis.String(reply[0], nil)
+		switch kind {
+		case "subscribe":
+			c.setTracking(true)
+		case "message":
+			//nil message means all keys should be invalidated,e.g. after FLUSHDB.
+			if reply[2] == nil {
+				c.setTracking(true)
+				continue
+			}
+			keys, err := redis.Strings(reply[2], nil)
+			if err != nil {
+				return err
+			}
+			c.invalidate(keys...)
+		}
+	}
+}
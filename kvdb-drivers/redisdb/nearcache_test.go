@@ -0,0 +1,289 @@
+package redisdb
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/herb-go/herbdata"
+)
+
+//fakeTracking emulate CLIENT ID and CLIENT TRACKING BCAST on miniredis,which does not support client tracking.
+type fakeTracking struct {
+	lock      sync.Mutex
+	ids       map[*server.Peer]int
+	peers     map[int]*server.Peer
+	redirects map[*server.Peer]*server.Peer
+	prefixes  map[*server.Peer]string
+}
+
+func newFakeTracking(m *miniredis.Miniredis) *fakeTracking {
+	t := &fakeTracking{
+		ids:       map[*server.Peer]int{},
+		peers:     map[int]*server.Peer{},
+		redirects: map[*server.Peer]*server.Peer{},
+		prefixes:  map[*server.Peer]string{},
+	}
+	m.Server().SetPreHook(t.hook)
+	return t
+}
+
+func (t *fakeTracking) hook(c *server.Peer, cmd string, args ...string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	switch cmd {
+	case "CLIENT":
+		if len(args) == 1 && strings.ToUpper(args[0]) == "ID" {
+			if _, ok := t.ids[c]; !ok {
+				id := len(t.ids) + 1
+				t.ids[c] = id
+				t.peers[id] = c
+				c.OnDisconnect(func() {
+					t.lock.Lock()
+					delete(t.redirects, c)
+					t.lock.Unlock()
+				})
+			}
+			c.WriteInt(t.ids[c])
+			return true
+		}
+		if len(args) > 1 && strings.ToUpper(args[0]) == "TRACKING" {
+			if strings.ToLower(args[1]) == "off" {
+				delete(t.redirects, c)
+				c.WriteOK()
+				return true
+			}
+			//on REDIRECT id BCAST PREFIX prefix
+			id, _ := strconv.Atoi(args[3])
+			t.redirects[c] = t.peers[id]
+			t.prefixes[c] = args[6]
+			c.WriteOK()
+			return true
+		}
+	case "SET", "DEL", "INCRBY", "EXPIRE":
+		for client, target := range t.redirects {
+			for _, key := range args[:1] {
+				if strings.HasPrefix(key, t.prefixes[client]) {
+					target.Block(func(w *server.Writer) {
+						w.WriteLen(3)
+						w.WriteBulk("message")
+						w.WriteBulk(invalidateChannel)
+						w.WriteLen(1)
+						w.WriteBulk(key)
+					})
+					target.Flush()
+				}
+			}
+		}
+	case "FLUSHDB", "FLUSHALL":
+		for _, target := range t.redirects {
+			target.Block(func(w *server.Writer) {
+				w.WriteLen(3)
+				w.WriteBulk("message")
+				w.WriteBulk(invalidateChannel)
+				w.WriteNull()
+			})
+			target.Flush()
+		}
+	}
+	return false
+}
+
+func (t *fakeTracking) tracking() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.redirects)
+}
+
+func newTestNearCacheDriver(m *miniredis.Miniredis, size int) *Driver {
+	c := &Config{}
+	c.Network = "tcp"
+	c.Address = m.Addr()
+	c.MaxIdle = 10
+	c.Prefix = "nearcache"
+	c.NearCacheSize = size
+	d, err := c.CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	driver := d.(*Driver)
+	driver.SetErrorHandler(func(error) {})
+	if driver.NearCache != nil {
+		driver.NearCache.RetryInterval = 10 * time.Millisecond
+	}
+	return driver
+}
+
+func waitNearCache(t *testing.T, f func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNearCache(t *testing.T) {
+	m := miniredis.RunT(t)
+	tracking := newFakeTracking(m)
+	d := newTestNearCacheDriver(m, 2)
+	other := newTestNearCacheDriver(m, 0)
+	defer other.Close()
+	err := d.Set([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	//values are not cached before tracking started
+	for i := 0; i < 2; i++ {
+		data, err := d.Get([]byte("key"))
+		if err != nil || string(data) != "value" {
+			t.Fatal(string(data), err)
+		}
+	}
+	if stats := d.NearCache.Stats(); stats.Hits != 0 || stats.Misses != 2 || stats.Entries != 0 {
+		t.Fatal(stats)
+	}
+	err = d.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitNearCache(t, func() bool {
+		d.Get([]byte("key"))
+		return d.NearCache.Stats().Entries == 1
+	})
+	hits := d.NearCache.Stats().Hits
+	m.Set(d.getKey([]byte("key")), "changedwithoutnotification")
+	data, err := d.Get([]byte("key"))
+	if err != nil || string(data) != "value" || d.NearCache.Stats().Hits != hits+1 {
+		t.Fatal(string(data), err)
+	}
+	//returned value should be copied
+	data[0] = 'V'
+	data, err = d.Get([]byte("key"))
+	if err != nil || string(data) != "value" {
+		t.Fatal(string(data), err)
+	}
+	//written by other client
+	err = other.Set([]byte("key"), []byte("value2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitNearCache(t, func() bool {
+		return d.NearCache.Stats().Entries == 0
+	})
+	data, err = d.Get([]byte("key"))
+	if err != nil || string(data) != "value2" {
+		t.Fatal(string(data), err)
+	}
+	//written by driver itself should be invalidated synchronously
+	err = d.Set([]byte("key"), []byte("value3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = d.Get([]byte("key"))
+	if err != nil || string(data) != "value3" {
+		t.Fatal(string(data), err)
+	}
+	err = d.Delete([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.Get([]byte("key"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	//lru
+	for _, v := range []string{"a", "b", "c"} {
+		err = d.Set([]byte(v), []byte(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	//invalidation messages of writes above are received asynchronously
+	waitNearCache(t, func() bool {
+		d.Get([]byte("a"))
+		d.Get([]byte("b"))
+		d.Get([]byte("c"))
+		return d.NearCache.Stats().Entries == 2
+	})
+	hits = d.NearCache.Stats().Hits
+	d.Get([]byte("c"))
+	d.Get([]byte("a"))
+	if d.NearCache.Stats().Hits != hits+1 {
+		t.Fatal(d.NearCache.Stats())
+	}
+	//flush invalidates all
+	conn := other.Pool.Get()
+	_, err = conn.Do("FLUSHDB")
+	conn.Close()
+	if err != nil {
+		panic(err)
+	}
+	waitNearCache(t, func() bool {
+		return d.NearCache.Stats().Entries == 0
+	})
+	//cache is flushed and bypassed after connection lost
+	d.Set([]byte("key"), []byte("value"))
+	d.Get([]byte("key"))
+	m.Close()
+	waitNearCache(t, func() bool {
+		return d.NearCache.Stats().Entries == 0
+	})
+	err = m.Restart()
+	if err != nil {
+		panic(err)
+	}
+	//hook is lost after restarted
+	tracking = newFakeTracking(m)
+	waitNearCache(t, func() bool {
+		d.Get([]byte("key"))
+		return d.NearCache.Stats().Entries == 1
+	})
+	d.Close()
+	if d.NearCache.Stats().Entries != 0 {
+		t.Fatal(d.NearCache.Stats())
+	}
+	waitNearCache(t, func() bool {
+		return tracking.tracking() == 0
+	})
+}
+
+func TestNearCacheCluster(t *testing.T) {
+	c := &Config{}
+	c.Cluster = true
+	c.Address = "127.0.0.1:6379"
+	c.NearCacheSize = 10
+	_, err := c.CreateDriver()
+	if err != ErrNearCacheWithCluster {
+		t.Fatal(err)
+	}
+	c = &Config{}
+	c.SentinelMasterName = "mymaster"
+	c.SentinelAddresses = []string{"127.0.0.1:26379"}
+	c.ReadFromReplicas = true
+	c.NearCacheSize = 10
+	_, err = c.CreateDriver()
+	if err != ErrNearCacheWithReplicas {
+		t.Fatal(err)
+	}
+}
+
+func TestNearCacheStopHalfOpen(t *testing.T) {
+	d := newHalfOpenTestDriver(t)
+	d.NearCache = NewNearCache(10)
+	err := d.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitNearCache(t, func() bool {
+		d.NearCache.lock.Lock()
+		defer d.NearCache.lock.Unlock()
+		return d.NearCache.tracking
+	})
+	waitClosed(t, d.Close)
+}
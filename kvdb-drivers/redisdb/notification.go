@@ -0,0 +1,276 @@
+package redisdb
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/herb-go/herbdata-drivers/kvdb-drivers/internal/redisscan"
+	"github.com/herb-go/herbdata/kvdb"
+)
+
+//EventType type of keyspace event
+type EventType string
+
+//EventSet value or counter is set or changed
+const EventSet = EventType("set")
+
+//EventDel value or counter is deleted
+const EventDel = EventType("del")
+
+//EventExpired value or counter is expired or evicted by redis
+const EventExpired = EventType("expired")
+
+//EventReconnected subscription reconnected after connection lost.
+//Events happened while disconnected are lost,caches should be flushed.
+const EventReconnected = EventType("reconnected")
+
+//DefaultSubscriptionRetryInterval default interval to wait before resubscribing keyspace events
+var DefaultSubscriptionRetryInterval = time.Second
+
+//NotifyKeyspaceEvents keyspace event flags enabled by driver:
+//K keyspace events,$ string commands,g generic commands,x expired events,e evicted events.
+const NotifyKeyspaceEvents = "K$gxe"
+
+//Event keyspace event of driver key
+type Event struct {
+	//Type event type
+	Type EventType
+	//Key original key passed to driver.
+	//Key will be nil for EventReconnected.
+	//Key will be hashed key used in redis if key is longer than MaxKeyLength of driver.
+	Key []byte
+	//Counter if key is counter key
+	Counter bool
+}
+
+var eventTypes = map[string]EventType{
+	"set":         EventSet,
+	"setrange":    EventSet,
+	"append":      EventSet,
+	"incrby":      EventSet,
+	"incrbyfloat": EventSet,
+	"del":         EventDel,
+	"expired":     EventExpired,
+	"evicted":     EventExpired,
+}
+
+//Subscription keyspace event subscription
+type Subscription struct {
+	//RetryInterval interval to wait before resubscribing after connection lost.
+	RetryInterval time.Duration
+	events        chan *Event
+	stopped       chan struct{}
+	errhandler    func(error)
+	pattern       string
+	channelprefix string
+	prefix        string
+	lock          sync.Mutex
+	conns         map[*redis.PubSubConn]bool
+	wg            sync.WaitGroup
+}
+
+//Events return channel which delivers events.
+//Channel will be closed after subscription closed.
+func (s *Subscription) Events() <-chan *Event {
+	return s.events
+}
+
+//Close close subscription.
+func (s *Subscription) Close() error {
+	s.lock.Lock()
+	select {
+	case <-s.stopped:
+		s.lock.Unlock()
+		return nil
+	default:
+	}
+	close(s.stopped)
+	for psc := range s.conns {
+		//closing connection unblocks receiving loop even if server never replies
+		psc.Close()
+	}
+	s.lock.Unlock()
+	s.wg.Wait()
+	close(s.events)
+	return nil
+}
+
+//decode decode keyspace channel and event name into event.
+//Return nil if key is not data or counter key of driver or event is not concerned.
+func (s *Subscription) decode(channel string, event string) *Event {
+	t, ok := eventTypes[event]
+	if !ok || !strings.HasPrefix(channel, s.channelprefix+s.prefix) {
+		return nil
+	}
+	key := channel[len(s.channelprefix)+len(s.prefix):]
+	if strings.HasPrefix(key, string(kvdb.SuggestedDataPrefix)) {
+		return &Event{Type: t, Key: []byte(key[len(string(kvdb.SuggestedDataPrefix)):])}
+	}
+	if strings.HasPrefix(key, string(kvdb.SuggestedCounterPrefix)) {
+		return &Event{Type: t, Key: []byte(key[len(string(kvdb.SuggestedCounterPrefix)):]), Counter: true}
+	}
+	return nil
+}
+
+func (s *Subscription) deliver(e *Event) bool {
+	select {
+	case s.events <- e:
+		return true
+	case <-s.stopped:
+		return false
+	}
+}
+
+func (s *Subscription) watch(dial func() redis.Conn) {
+	defer s.wg.Done()
+	reconnected := false
+	for {
+		err := s.receive(dial, reconnected)
+		select {
+		case <-s.stopped:
+			return
+		default:
+		}
+		if err != nil {
+			s.errhandler(err)
+		}
+		reconnected = true
+		select {
+		case <-s.stopped:
+			return
+		case <-time.After(s.RetryInterval):
+		}
+	}
+}
+
+func (s *Subscription) receive(dial func() redis.Conn, reconnected bool) error {
+	psc := &redis.PubSubConn{Conn: dial()}
+	defer psc.Close()
+	err := psc.PSubscribe(s.pattern)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	select {
+	case <-s.stopped:
+		s.lock.Unlock()
+		return nil
+	default:
+	}
+	s.conns[psc] = true
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, psc)
+		s.lock.Unlock()
+	}()
+	for {
+		switch v := psc.ReceiveWithTimeout(0).(type) {
+		case redis.Subscription:
+			if v.Count == 0 {
+				return nil
+			}
+			if reconnected && !s.deliver(&Event{Type: EventReconnected}) {
+				return nil
+			}
+		case redis.Message:
+			e := s.decode(v.Channel, string(v.Data))
+			if e != nil && !s.deliver(e) {
+				return nil
+			}
+		case error:
+			return v
+		}
+	}
+}
+
+//Subscribe subscribe keyspace events of keys under driver prefix.
+//Keyspace notifications will be enabled with CONFIG SET if EnableNotifications is true,
+//otherwise notify-keyspace-events should be configured on redis server.
+//In cluster mode all master nodes known when subscribing are watched.
+//Return subscription and any error if raised.
+func (d *Driver) Subscribe() (*Subscription, error) {
+	var dialers []func() redis.Conn
+	if d.Cluster != nil {
+		masters, err := d.Cluster.Masters()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range masters {
+			addr := v
+			dialers = append(dialers, func() redis.Conn {
+				return d.dialConn(addr)
+			})
+		}
+	} else {
+		dialers = append(dialers, func() redis.Conn {
+			return d.dialConn("")
+		})
+	}
+	if d.EnableNotifications {
+		for _, dial := range dialers {
+			err := enableNotifications(dial())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	errhandler := d.ErrHandler
+	if errhandler == nil {
+		errhandler = defaultErrHandler
+	}
+	channelprefix := "__keyspace@" + strconv.Itoa(d.Db) + "__:"
+	s := &Subscription{
+		RetryInterval: DefaultSubscriptionRetryInterval,
+		events:        make(chan *Event),
+		stopped:       make(chan struct{}),
+		errhandler:    errhandler,
+		pattern:       redisscan.EscapePattern(channelprefix+d.Prefix) + "*",
+		channelprefix: channelprefix,
+		prefix:        d.Prefix,
+		conns:         map[*redis.PubSubConn]bool{},
+	}
+	s.wg.Add(len(dialers))
+	for _, dial := range dialers {
+		go s.watch(dial)
+	}
+	return s, nil
+}
+
+//enableNotifications add flags in NotifyKeyspaceEvents to notify-keyspace-events config with given connection.
+//Connection will be closed.
+func enableNotifications(conn redis.Conn) error {
+	defer conn.Close()
+	config, err := redis.Strings(conn.Do("CONFIG", "GET", "notify-keyspace-events"))
+	if err != nil {
+		return err
+	}
+	var flags string
+	if len(config) == 2 {
+		flags = config[1]
+	}
+	merged := mergeNotifyFlags(flags, NotifyKeyspaceEvents)
+	if merged == flags {
+		return nil
+	}
+	_, err = conn.Do("CONFIG", "SET", "notify-keyspace-events", merged)
+	return err
+}
+
+//mergeNotifyFlags add flags to notify-keyspace-events config.
+//Flag "A" is alias for "g$lshzxetd".
+func mergeNotifyFlags(flags string, added string) string {
+	for _, v := range added {
+		if strings.ContainsRune(flags, v) {
+			continue
+		}
+		if strings.ContainsRune(flags, 'A') && strings.ContainsRune("g$lshzxetd", v) {
+			continue
+		}
+		flags = flags + string(v)
+	}
+	return flags
+}
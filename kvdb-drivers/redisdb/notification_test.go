@@ -0,0 +1,242 @@
+package redisdb
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+func newTestNotificationDriver(m *miniredis.Miniredis) *Driver {
+	c := &Config{}
+	c.Network = "tcp"
+	c.Address = m.Addr()
+	c.MaxIdle = 10
+	c.Prefix = "notification*"
+	c.EnableNotifications = true
+	d, err := c.CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	driver := d.(*Driver)
+	driver.SetErrorHandler(func(error) {})
+	return driver
+}
+
+//registerConfig register CONFIG command which miniredis does not support.
+func registerConfig(m *miniredis.Miniredis, config map[string]string) {
+	m.Server().Register("CONFIG", func(c *server.Peer, cmd string, args []string) {
+		if len(args) == 2 && args[0] == "GET" {
+			c.WriteStrings([]string{args[1], config[args[1]]})
+			return
+		}
+		if len(args) == 3 && args[0] == "SET" {
+			config[args[1]] = args[2]
+			c.WriteOK()
+			return
+		}
+		c.WriteError("ERR syntax error")
+	})
+}
+
+func receiveEvent(t *testing.T, s *Subscription) *Event {
+	select {
+	case e := <-s.Events():
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("event timeout")
+	}
+	return nil
+}
+
+func TestSubscribe(t *testing.T) {
+	m := miniredis.RunT(t)
+	config := map[string]string{"notify-keyspace-events": "Ez"}
+	registerConfig(m, config)
+	d := newTestNotificationDriver(m)
+	defer d.Close()
+	s, err := d.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.RetryInterval = 10 * time.Millisecond
+	if config["notify-keyspace-events"] != "EzK$gxe" {
+		t.Fatal(config)
+	}
+	for m.PubSubNumPat() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	//miniredis does not publish keyspace events,so publish them as redis does.
+	m.Publish("__keyspace@0__:"+d.getKey([]byte("key")), "set")
+	m.Publish("__keyspace@0__:"+d.getKey([]byte("key")), "expire")
+	m.Publish("__keyspace@0__:"+d.getCounterKey([]byte("counter")), "incrby")
+	m.Publish("__keyspace@1__:"+d.getKey([]byte("otherdb")), "del")
+	m.Publish("__keyspace@0__:notification"+d.getKey([]byte("otherprefix")), "del")
+	m.Publish("__keyspace@0__:"+d.getKey([]byte("key")), "del")
+	m.Publish("__keyspace@0__:"+d.getCounterKey([]byte("counter")), "expired")
+	expected := []Event{
+		{Type: EventSet, Key: []byte("key")},
+		{Type: EventSet, Key: []byte("counter"), Counter: true},
+		{Type: EventDel, Key: []byte("key")},
+		{Type: EventExpired, Key: []byte("counter"), Counter: true},
+	}
+	for _, v := range expected {
+		e := receiveEvent(t, s)
+		if e.Type != v.Type || string(e.Key) != string(v.Key) || e.Counter != v.Counter {
+			t.Fatal(e, v)
+		}
+	}
+	m.Close()
+	err = m.Restart()
+	if err != nil {
+		panic(err)
+	}
+	registerConfig(m, config)
+	e := receiveEvent(t, s)
+	if e.Type != EventReconnected || e.Key != nil {
+		t.Fatal(e)
+	}
+	m.Publish("__keyspace@0__:"+d.getKey([]byte("key2")), "set")
+	e = receiveEvent(t, s)
+	if e.Type != EventSet || string(e.Key) != "key2" {
+		t.Fatal(e)
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok := <-s.Events()
+	if ok {
+		t.Fatal(ok)
+	}
+}
+
+//newHalfOpenServer start server which replies commands until subscribed,and never replies after that,
+//like a redis server behind a partitioned network.
+//Return server address.
+func newHalfOpenServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveHalfOpen(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func serveHalfOpen(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	subscribed := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			_, err = r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			arg, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			args[i] = strings.TrimSpace(arg)
+		}
+		if subscribed || n == 0 {
+			continue
+		}
+		switch cmd := strings.ToLower(args[0]); cmd {
+		case "subscribe", "psubscribe":
+			subscribed = true
+			fmt.Fprintf(conn, "*3\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n:1\r\n", len(cmd), cmd, len(args[1]), args[1])
+		case "client":
+			if strings.ToLower(args[1]) == "id" {
+				fmt.Fprint(conn, ":1\r\n")
+				continue
+			}
+			fmt.Fprint(conn, "+OK\r\n")
+		default:
+			fmt.Fprint(conn, "+OK\r\n")
+		}
+	}
+}
+
+func newHalfOpenTestDriver(t *testing.T) *Driver {
+	c := &Config{}
+	c.Network = "tcp"
+	c.Address = newHalfOpenServer(t)
+	c.MaxIdle = 10
+	d, err := c.CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	driver := d.(*Driver)
+	driver.SetErrorHandler(func(error) {})
+	return driver
+}
+
+//waitClosed wait until given close function returns.
+func waitClosed(t *testing.T, close func() error) {
+	closed := make(chan error, 1)
+	go func() {
+		closed <- close()
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("close timeout")
+	}
+}
+
+func TestSubscriptionCloseHalfOpen(t *testing.T) {
+	d := newHalfOpenTestDriver(t)
+	defer d.Close()
+	s, err := d.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		s.lock.Lock()
+		subscribed := len(s.conns) > 0
+		s.lock.Unlock()
+		if subscribed {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	waitClosed(t, s.Close)
+}
+
+func TestMergeNotifyFlags(t *testing.T) {
+	if mergeNotifyFlags("", NotifyKeyspaceEvents) != "K$gxe" {
+		t.Fatal(mergeNotifyFlags("", NotifyKeyspaceEvents))
+	}
+	if mergeNotifyFlags("AK", NotifyKeyspaceEvents) != "AK" {
+		t.Fatal(mergeNotifyFlags("AK", NotifyKeyspaceEvents))
+	}
+	if mergeNotifyFlags("KEA", NotifyKeyspaceEvents) != "KEA" {
+		t.Fatal(mergeNotifyFlags("KEA", NotifyKeyspaceEvents))
+	}
+}
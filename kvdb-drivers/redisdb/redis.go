@@ -1,17 +1,53 @@
 package redisdb
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"time"
+
 	"github.com/gomodule/redigo/redis"
 	"github.com/herb-go/datasource/redis/redispool"
 	"github.com/herb-go/herbdata"
+	"github.com/herb-go/herbdata-drivers/kvdb-drivers/internal/redisscan"
 	"github.com/herb-go/herbdata/kvdb"
 )
 
 type Driver struct {
 	kvdb.Nop
-	Pool    *redis.Pool
-	NoMulti bool
-	Prefix  string
+	Pool *redis.Pool
+	//Cluster redis cluster client.
+	//Pool will not be used if Cluster is not nil.
+	Cluster *Cluster
+	//Sentinel redis sentinel client.
+	//Pool will not be used if Sentinel is not nil.
+	Sentinel *Sentinel
+	NoMulti  bool
+	//UseScript run IncreaseCounterWithTTL with lua script instead of MULTI/EXEC.
+	//TTL counter feature is available even if NoMulti is true when UseScript is enabled.
+	UseScript bool
+	Prefix    string
+	//Db redis database number used in keyspace notification channels.
+	Db int
+	//EnableNotifications enable keyspace notifications with CONFIG SET when subscribing.
+	EnableNotifications bool
+	//ErrHandler handler for errors raised in background.
+	ErrHandler func(error)
+	//Compressor compressor used to encode values.
+	//Counters are never compressed.
+	Compressor *Compressor
+	//MaxKeyLength keys longer than MaxKeyLength will be hashed with sha256.
+	//Keys will not be hashed if MaxKeyLength is 0.
+	MaxKeyLength int
+	//StoreOriginalKey store original key of hashed key before value,
+	//so that Next can return original key.
+	StoreOriginalKey bool
+	//Breaker circuit breaker around operations.
+	//Circuit breaker is disabled if nil.
+	Breaker *Breaker
+	//NearCache local cache of values invalidated by redis client tracking.
+	//Near cache is disabled if nil.
+	NearCache *NearCache
 }
 
 var FullFeatures = kvdb.FeatureStore |
@@ -21,77 +57,350 @@ var FullFeatures = kvdb.FeatureStore |
 	kvdb.FeatureTTLStore |
 	kvdb.FeatureTTLInsert |
 	kvdb.FeatureTTLUpdate |
-	kvdb.FeatureTTLCounter
+	kvdb.FeatureTTLCounter |
+	kvdb.FeatureNext
 var NoMutliFeatures = kvdb.FeatureStore |
 	kvdb.FeatureInsert |
 	kvdb.FeatureUpdate |
 	kvdb.FeatureCounter |
 	kvdb.FeatureTTLStore |
 	kvdb.FeatureTTLInsert |
-	kvdb.FeatureTTLUpdate
+	kvdb.FeatureTTLUpdate |
+	kvdb.FeatureNext
+
+//ErrInvalidIter error raised if iter passed to Next is not created by redis drivers
+var ErrInvalidIter = redisscan.ErrInvalidIter
 
 //Features return supported features
 func (d *Driver) Features() kvdb.Feature {
-	if d.NoMulti {
+	if d.NoMulti && !d.UseScript {
 		return NoMutliFeatures
 	}
 	return FullFeatures
 }
 
+//SetErrorHandler set handler for errors raised in background.
+func (d *Driver) SetErrorHandler(f func(error)) {
+	d.ErrHandler = f
+	if d.Sentinel != nil {
+		d.Sentinel.ErrHandler = f
+	}
+}
+
+//Start start database
+//Near cache starts tracking keys after started.
+func (d *Driver) Start() error {
+	if d.Sentinel != nil {
+		err := d.Sentinel.Start()
+		if err != nil {
+			return err
+		}
+	}
+	if d.NearCache != nil {
+		errhandler := d.ErrHandler
+		if errhandler == nil {
+			errhandler = defaultErrHandler
+		}
+		d.NearCache.start(func() redis.Conn {
+			return d.dialConn("")
+		}, d.getKey(nil), errhandler)
+	}
+	return nil
+}
+
 // Close close database
 func (d *Driver) Close() error {
+	if d.NearCache != nil {
+		d.NearCache.stop()
+	}
+	if d.Cluster != nil {
+		return d.Cluster.Close()
+	}
+	if d.Sentinel != nil {
+		return d.Sentinel.Close()
+	}
 	return d.Pool.Close()
 }
+
+//getConn get connection for given redis key
+func (d *Driver) getConn(key string) redis.Conn {
+	return d.guard(func() redis.Conn {
+		return d.conn(key)
+	})
+}
+
+//conn get connection for given redis key without circuit breaker
+func (d *Driver) conn(key string) redis.Conn {
+	if d.Cluster != nil {
+		return d.Cluster.Get(key)
+	}
+	if d.Sentinel != nil {
+		return d.Sentinel.Get()
+	}
+	return d.Pool.Get()
+}
+
+//dialConn dial new connection to redis server or given cluster node address,which is not managed by pool.
+//Connection should be closed to unblock commands waiting for replies,
+//so it is used by subscriptions which receive replies in background.
+func (d *Driver) dialConn(addr string) redis.Conn {
+	var conn redis.Conn
+	var err error
+	switch {
+	case d.Cluster != nil:
+		conn, err = dialPool(d.Cluster.pool(addr))
+	case d.Sentinel != nil:
+		conn, err = d.Sentinel.dialMaster()
+	default:
+		conn, err = dialPool(d.Pool)
+	}
+	if err != nil {
+		return errorConn{err: err}
+	}
+	return conn
+}
+
+//dialPool dial new connection with dialer of given pool.
+func dialPool(p *redis.Pool) (redis.Conn, error) {
+	if p.DialContext != nil {
+		return p.DialContext(context.Background())
+	}
+	return p.Dial()
+}
+
+//getReadConn get connection for read only commands with given redis key.
+//Replica connection will be returned if reading from replicas is enabled in sentinel mode.
+func (d *Driver) getReadConn(key string) redis.Conn {
+	if d.Sentinel != nil {
+		return d.guard(d.Sentinel.GetReplica)
+	}
+	return d.getConn(key)
+}
+
+//getNodeConn get connection of given cluster node address.
+func (d *Driver) getNodeConn(addr string) redis.Conn {
+	return d.guard(func() redis.Conn {
+		return d.Cluster.GetNode(addr)
+	})
+}
+
 func (d *Driver) getKey(key []byte) string {
-	return d.Prefix + string(kvdb.SuggestedDataPrefix) + string(key)
+	return d.Prefix + string(kvdb.SuggestedDataPrefix) + d.hashKey(key)
 }
 func (d *Driver) getCounterKey(key []byte) string {
-	return d.Prefix + string(kvdb.SuggestedCounterPrefix) + string(key)
+	return d.Prefix + string(kvdb.SuggestedCounterPrefix) + d.hashKey(key)
 }
 
 //Set set value by given key
 func (d *Driver) Set(key []byte, value []byte) error {
-	conn := d.Pool.Get()
+	data, err := d.encodeValue(key, value)
+	if err != nil {
+		return err
+	}
+	k := d.getKey(key)
+	conn := d.getConn(k)
 	defer conn.Close()
-	_, err := conn.Do("SET", d.getKey(key), value)
+	defer d.invalidate(k)
+	_, err = conn.Do("SET", k, data)
 	return convertError(err)
 }
 
 //Get get value by given key
 func (d *Driver) Get(key []byte) ([]byte, error) {
-	conn := d.Pool.Get()
+	k := d.getKey(key)
+	var seq uint64
+	if d.NearCache != nil {
+		data, current, ok := d.NearCache.get(k)
+		if ok {
+			return data, nil
+		}
+		seq = current
+	}
+	conn := d.getReadConn(k)
 	defer conn.Close()
-	data, err := redis.Bytes(conn.Do("GET", d.getKey(key)))
+	data, err := redis.Bytes(conn.Do("GET", k))
 	if err != nil {
 		return nil, convertError(err)
 	}
-	return data, nil
+	value, err := d.decodeValue(key, data)
+	if err != nil {
+		return nil, err
+	}
+	if d.NearCache != nil {
+		d.NearCache.set(k, value, seq)
+	}
+	return value, nil
+}
+
+//invalidate remove values of given redis keys from near cache after written.
+func (d *Driver) invalidate(keys ...string) {
+	if d.NearCache != nil {
+		d.NearCache.invalidate(keys...)
+	}
 }
 
 //Delete delete value by given key
 func (d *Driver) Delete(key []byte) error {
-	conn := d.Pool.Get()
+	k := d.getKey(key)
+	conn := d.getConn(k)
 	defer conn.Close()
-	_, err := conn.Do("DEL", d.getKey(key))
+	defer d.invalidate(k)
+	_, err := conn.Do("DEL", k)
 	return convertError(err)
 }
 
+//Next return keys after iter not more than given limit
+//Empty iter (nil or 0 length []byte) will start a new search
+//Return keyvalue ,newiter and any error if raised.
+//Empty iter (nil or 0 length []byte) will be returned if no more keys
+//
+//Keys are walked with redis SCAN command,so unlike embedded drivers they are NOT returned in byte order.
+//Keys added or removed during iteration may or may not be returned,
+//and a key may be returned more than once if redis rehashes its dict during iteration.
+//Keys scanned but not returned because of limit are kept in newiter,
+//so newiter may contain up to limit keys.
+//In cluster mode master nodes are scanned one by one in address order.
+//In sentinel mode keys are scanned on master even if ReadFromReplicas is enabled.
+//Values stored with hashed keys are skipped if original keys are not stored.
+func (d *Driver) Next(iter []byte, limit int) (result []*herbdata.KeyValue, newiter []byte, err error) {
+	nodes := []string{""}
+	if d.Cluster != nil {
+		nodes, err = d.Cluster.Masters()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return redisscan.Next(iter, limit, d.getKey(nil), nodes, func(node string) (redisscan.Client, func()) {
+		var conn redis.Conn
+		if d.Cluster == nil {
+			//SCAN cursor is only valid on instance which issued it,
+			//so keys are always walked on master instead of round-robin replicas
+			conn = d.getConn("")
+		} else {
+			conn = d.getNodeConn(node)
+		}
+		return &scanClient{driver: d, conn: conn}, func() { conn.Close() }
+	})
+}
+
+//scanClient client which walks keys with given connection.
+type scanClient struct {
+	driver *Driver
+	conn   redis.Conn
+}
+
+//Scan run SCAN command with given cursor,MATCH pattern and COUNT.
+func (c *scanClient) Scan(cursor string, pattern string, count int) (string, []string, error) {
+	var next string
+	var keys []string
+	values, err := redis.Values(c.conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", count))
+	if err != nil {
+		return "", nil, convertError(err)
+	}
+	_, err = redis.Scan(values, &next, &keys)
+	if err != nil {
+		return "", nil, err
+	}
+	return next, keys, nil
+}
+
+//Fetch load key-values of given redis keys.
+func (c *scanClient) Fetch(keys []string) ([]*herbdata.KeyValue, error) {
+	return c.driver.fetch(c.conn, keys)
+}
+
+//fetch load values of given redis keys with MGET.
+//Keys expired or deleted after scanned will be skipped.
+//In cluster mode keys may belong to different slots,so pipelined GET is used instead.
+func (d *Driver) fetch(conn redis.Conn, keys []string) ([]*herbdata.KeyValue, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	var values [][]byte
+	var err error
+	if d.Cluster != nil {
+		values, err = pipelineGet(conn, keys)
+	} else {
+		args := make([]interface{}, len(keys))
+		for k := range keys {
+			args[k] = keys[k]
+		}
+		values, err = redis.ByteSlices(conn.Do("MGET", args...))
+	}
+	if err != nil {
+		return nil, convertError(err)
+	}
+	prefixlen := len(d.getKey(nil))
+	result := make([]*herbdata.KeyValue, 0, len(keys))
+	for k := range keys {
+		if values[k] == nil {
+			continue
+		}
+		key := []byte(keys[k][prefixlen:])
+		data := values[k]
+		if d.isHashedRedisKey(keys[k][prefixlen:]) {
+			key, data = unwrapOriginalKey(data)
+			//original key of hashed key is not stored
+			if key == nil {
+				continue
+			}
+		}
+		value, err := d.decode(data)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &herbdata.KeyValue{
+			Key:   key,
+			Value: value,
+		})
+	}
+	return result, nil
+}
+
+func pipelineGet(conn redis.Conn, keys []string) ([][]byte, error) {
+	for k := range keys {
+		err := conn.Send("GET", keys[k])
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := conn.Flush()
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(keys))
+	for k := range keys {
+		values[k], err = redis.Bytes(conn.Receive())
+		if err != nil && err != redis.ErrNil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
 //SetWithTTL set value by given key and ttl in second
 func (d *Driver) SetWithTTL(key []byte, value []byte, ttlInSecond int64) error {
 	if ttlInSecond <= 0 {
 		return herbdata.ErrInvalidatedTTL
 	}
-	conn := d.Pool.Get()
+	data, err := d.encodeValue(key, value)
+	if err != nil {
+		return err
+	}
+	k := d.getKey(key)
+	conn := d.getConn(k)
 	defer conn.Close()
-	_, err := conn.Do("SET", d.getKey(key), value, "EX", ttlInSecond)
+	defer d.invalidate(k)
+	_, err = conn.Do("SET", k, data, "EX", ttlInSecond)
 	return convertError(err)
 }
 
 //SetCounter set counter value with given key
 func (d *Driver) SetCounter(key []byte, value int64) error {
-	conn := d.Pool.Get()
+	k := d.getCounterKey(key)
+	conn := d.getConn(k)
 	defer conn.Close()
-	_, err := conn.Do("SET", d.getCounterKey(key), value)
+	_, err := conn.Do("SET", k, value)
 	return convertError(err)
 }
 
@@ -99,9 +408,10 @@ func (d *Driver) SetCounter(key []byte, value int64) error {
 //Value not existed coutn as 0.
 //Return final value and any error if raised.
 func (d *Driver) IncreaseCounter(key []byte, incr int64) (int64, error) {
-	conn := d.Pool.Get()
+	k := d.getCounterKey(key)
+	conn := d.getConn(k)
 	defer conn.Close()
-	data, err := redis.Int64(conn.Do("INCRBY", d.getCounterKey(key), incr))
+	data, err := redis.Int64(conn.Do("INCRBY", k, incr))
 	return data, convertError(err)
 }
 
@@ -109,33 +419,35 @@ func (d *Driver) IncreaseCounter(key []byte, incr int64) (int64, error) {
 //Value not existed coutn as 0.
 //Return final value and any error if raised.
 func (d *Driver) IncreaseCounterWithTTL(key []byte, incr int64, ttlInSecond int64) (int64, error) {
-	if d.NoMulti {
+	if d.NoMulti && !d.UseScript {
 		return 0, kvdb.ErrFeatureNotSupported
 	}
-	var err error
 	if ttlInSecond <= 0 {
 		return 0, herbdata.ErrInvalidatedTTL
 	}
-	conn := d.Pool.Get()
+	k := d.getCounterKey(key)
+	conn := d.getConn(k)
 	defer conn.Close()
-	_, err = conn.Do("Multi")
+	if d.UseScript {
+		data, err := redis.Int64(increaseCounterWithTTLScript.Do(conn, k, incr, ttlInSecond))
+		return data, convertError(err)
+	}
+	_, err := conn.Do("MULTI")
 	if err != nil {
-		return 0, err
+		return 0, convertError(err)
 	}
-	err = conn.Send("INCRBY", d.getCounterKey(key), incr)
-	err = convertError(err)
+	err = conn.Send("INCRBY", k, incr)
 	if err != nil {
-		return 0, err
+		return 0, convertError(err)
 	}
-	err = conn.Send("EXPIRE", d.getCounterKey(key), ttlInSecond)
-	err = convertError(err)
+	err = conn.Send("EXPIRE", k, ttlInSecond)
 	if err != nil {
-		return 0, err
+		return 0, convertError(err)
 	}
 	var data int64
-	result, err := redis.Values(conn.Do("Exec"))
+	result, err := redis.Values(conn.Do("EXEC"))
 	if err != nil {
-		return 0, err
+		return 0, convertError(err)
 	}
 	_, err = redis.Scan(result, &data)
 	if err != nil {
@@ -145,14 +457,23 @@ func (d *Driver) IncreaseCounterWithTTL(key []byte, incr int64, ttlInSecond int6
 	return data, nil
 }
 
+//increaseCounterWithTTLScript script increase counter and set ttl atomically.
+//Script.Do sends EVALSHA and falls back to EVAL if script is not loaded.
+var increaseCounterWithTTLScript = redis.NewScript(1, `
+local value = redis.call('INCRBY', KEYS[1], ARGV[1])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return value
+`)
+
 //SetCounterWithTTL set counter value with given key and ttl in second
 func (d *Driver) SetCounterWithTTL(key []byte, value int64, ttlInSecond int64) error {
 	if ttlInSecond <= 0 {
 		return herbdata.ErrInvalidatedTTL
 	}
-	conn := d.Pool.Get()
+	k := d.getCounterKey(key)
+	conn := d.getConn(k)
 	defer conn.Close()
-	_, err := conn.Do("SET", d.getCounterKey(key), value, "EX", ttlInSecond)
+	_, err := conn.Do("SET", k, value, "EX", ttlInSecond)
 
 	return convertError(err)
 }
@@ -160,9 +481,10 @@ func (d *Driver) SetCounterWithTTL(key []byte, value int64, ttlInSecond int64) e
 //GetCounter get counter value with given key
 //Value not existed coutn as 0.
 func (d *Driver) GetCounter(key []byte) (int64, error) {
-	conn := d.Pool.Get()
+	k := d.getCounterKey(key)
+	conn := d.getReadConn(k)
 	defer conn.Close()
-	data, err := redis.Int64(conn.Do("GET", d.getCounterKey(key)))
+	data, err := redis.Int64(conn.Do("GET", k))
 	err = convertError(err)
 	if err == herbdata.ErrNotFound {
 		return 0, nil
@@ -175,22 +497,29 @@ func (d *Driver) GetCounter(key []byte) (int64, error) {
 
 //DeleteCounter delete counter value with given key
 func (d *Driver) DeleteCounter(key []byte) error {
-	conn := d.Pool.Get()
+	k := d.getCounterKey(key)
+	conn := d.getConn(k)
 	defer conn.Close()
-	_, err := conn.Do("DEL", d.getCounterKey(key))
+	_, err := conn.Do("DEL", k)
 	return convertError(err)
 }
 
 //InsertWithTTL insert value with given key and ttl in second.
-//Insert will fail if data with given key exists.
-//Return if operation success and any error if raised
+// Insert will fail if data with given key exists.
+// Return if operation success and any error if raised
 func (d *Driver) InsertWithTTL(key []byte, value []byte, ttlInSecond int64) (bool, error) {
 	if ttlInSecond <= 0 {
 		return false, herbdata.ErrInvalidatedTTL
 	}
-	conn := d.Pool.Get()
+	data, err := d.encodeValue(key, value)
+	if err != nil {
+		return false, err
+	}
+	k := d.getKey(key)
+	conn := d.getConn(k)
 	defer conn.Close()
-	_, err := redis.String(conn.Do("SET", d.getKey(key), value, "EX", ttlInSecond, "NX"))
+	defer d.invalidate(k)
+	_, err = redis.String(conn.Do("SET", k, data, "EX", ttlInSecond, "NX"))
 	err = convertError(err)
 	if err == herbdata.ErrNotFound {
 		return false, nil
@@ -204,11 +533,17 @@ func (d *Driver) InsertWithTTL(key []byte, value []byte, ttlInSecond int64) (boo
 
 //Update update value with given key.
 //Update will fail if data with given key does nto exist.
-//Return if operation success and any error if raised
+// Return if operation success and any error if raised
 func (d *Driver) Update(key []byte, value []byte) (bool, error) {
-	conn := d.Pool.Get()
+	data, err := d.encodeValue(key, value)
+	if err != nil {
+		return false, err
+	}
+	k := d.getKey(key)
+	conn := d.getConn(k)
 	defer conn.Close()
-	_, err := redis.String(conn.Do("SET", d.getKey(key), value, "XX"))
+	defer d.invalidate(k)
+	_, err = redis.String(conn.Do("SET", k, data, "XX"))
 	err = convertError(err)
 	if err == herbdata.ErrNotFound {
 		return false, nil
@@ -221,14 +556,20 @@ func (d *Driver) Update(key []byte, value []byte) (bool, error) {
 
 //UpdateWithTTL update value with given key and ttl in second.
 //Update will fail if data with given key does nto exist.
-//Return if operation success and any error if raised
+// Return if operation success and any error if raised
 func (d *Driver) UpdateWithTTL(key []byte, value []byte, ttlInSecond int64) (bool, error) {
 	if ttlInSecond <= 0 {
 		return false, herbdata.ErrInvalidatedTTL
 	}
-	conn := d.Pool.Get()
+	data, err := d.encodeValue(key, value)
+	if err != nil {
+		return false, err
+	}
+	k := d.getKey(key)
+	conn := d.getConn(k)
 	defer conn.Close()
-	_, err := redis.String(conn.Do("SET", d.getKey(key), value, "EX", ttlInSecond, "XX"))
+	defer d.invalidate(k)
+	_, err = redis.String(conn.Do("SET", k, data, "EX", ttlInSecond, "XX"))
 	err = convertError(err)
 	if err == herbdata.ErrNotFound {
 		return false, nil
@@ -243,9 +584,15 @@ func (d *Driver) UpdateWithTTL(key []byte, value []byte, ttlInSecond int64) (boo
 // Insert will fail if data with given key exists.
 // Return if operation success and any error if raised
 func (d *Driver) Insert(key []byte, value []byte) (bool, error) {
-	conn := d.Pool.Get()
+	data, err := d.encodeValue(key, value)
+	if err != nil {
+		return false, err
+	}
+	k := d.getKey(key)
+	conn := d.getConn(k)
 	defer conn.Close()
-	_, err := redis.String(conn.Do("SET", d.getKey(key), value, "NX"))
+	defer d.invalidate(k)
+	_, err = redis.String(conn.Do("SET", k, data, "NX"))
 	err = convertError(err)
 	if err == herbdata.ErrNotFound {
 		return false, nil
@@ -257,15 +604,100 @@ func (d *Driver) Insert(key []byte, value []byte) (bool, error) {
 }
 
 func new() *Driver {
-	return &Driver{}
+	return &Driver{
+		ErrHandler: defaultErrHandler,
+	}
 }
 
 type Config struct {
 	redispool.Config
 	Prefix  string
 	NoMulti bool
+	//UseScript run IncreaseCounterWithTTL with lua script instead of MULTI/EXEC.
+	UseScript bool
+	//Cluster connect to redis cluster.
+	//Slots will be discovered from Address and ClusterAddresses.
+	//Db should be 0 in cluster mode,or ErrClusterDb will be raised.
+	Cluster bool
+	//ClusterAddresses extra cluster seed node addresses.
+	ClusterAddresses []string
+	//SentinelMasterName name of master monitored by sentinels.
+	//Sentinel mode will be enabled if SentinelMasterName is not empty,
+	//and Address will be ignored.
+	SentinelMasterName string
+	//SentinelAddresses sentinel addresses.
+	SentinelAddresses []string
+	//SentinelPassword password used to connect sentinels.
+	SentinelPassword string
+	//ReadFromReplicas send read commands to replicas in sentinel mode.
+	//Reads may return stale data because of replication lag.
+	//Next always walks keys on master,as SCAN cursors can not be resumed on other instances.
+	ReadFromReplicas bool
+	//Username ACL username used to AUTH with password on redis 6+.
+	Username string
+	//TLS connect redis with TLS.
+	TLS bool
+	//TLSCAFile path of PEM encoded CA certificates used to verify server.
+	//System CA will be used if empty.
+	TLSCAFile string
+	//TLSCertFile path of PEM encoded client certificate.
+	TLSCertFile string
+	//TLSKeyFile path of PEM encoded client private key.
+	TLSKeyFile string
+	//TLSServerName server name used for SNI and verifying server certificate.
+	//Host of address will be used if empty.
+	TLSServerName string
+	//TLSInsecureSkipVerify skip verifying server certificate.
+	TLSInsecureSkipVerify bool
+	//SentinelTLSServerName server name used for SNI and verifying sentinel certificates.
+	//Host of sentinel address will be used if empty,TLSServerName is never used for sentinels.
+	SentinelTLSServerName string
+	//EnableNotifications enable keyspace notifications with CONFIG SET when subscribing.
+	//Notifications should be configured on server if CONFIG command is not allowed.
+	EnableNotifications bool
+	//Compression compression used to encode values,"snappy","zstd","gzip" or "none".
+	//Compressed values are stored with a header and decoded transparently,
+	//so uncompressed values stored before enabling compression can still be read.
+	//Use "none" to stop compressing values while still decoding compressed ones.
+	//Counters are never compressed.
+	Compression string
+	//CompressionMinSize values shorter than CompressionMinSize will not be compressed.
+	CompressionMinSize int
+	//MaxKeyLength keys longer than MaxKeyLength will be hashed with sha256 to bound redis key size.
+	//Keys will not be hashed if MaxKeyLength is 0.
+	//Changing MaxKeyLength makes values stored with hashed keys unreachable.
+	MaxKeyLength int
+	//StoreOriginalKey store original key of hashed key alongside value.
+	//Values of hashed keys are skipped by Next if original key not stored.
+	StoreOriginalKey bool
+	//CircuitBreaker enable circuit breaker.
+	//Operations fail fast with ErrCircuitOpen after too many consecutive connection errors.
+	CircuitBreaker bool
+	//BreakerThreshold count of consecutive connection errors to open circuit breaker.
+	//DefaultBreakerThreshold will be used if 0.
+	BreakerThreshold int
+	//BreakerOpenTimeoutInSecond seconds circuit breaker stays open before probing redis with PING.
+	//DefaultBreakerOpenTimeout will be used if 0.
+	BreakerOpenTimeoutInSecond int64
+	//NearCacheSize max count of values cached locally.
+	//Near cache requires redis 6+ CLIENT TRACKING and is disabled if 0.
+	//Values written by other clients are invalidated asynchronously,so Get may return stale value for a short while.
+	//Near cache can not be used in cluster mode or with ReadFromReplicas.
+	NearCacheSize int
+	//Hash store each namespace in one redis hash instead of one redis key per value.
+	//Namespace can be cleared with one DEL and sized with HLEN,
+	//but ttl features are only available if HashFieldTTL is enabled.
+	Hash bool
+	//HashNamespace namespace used in hash mode.
+	//Namespace should not start with byte 0x00 or 0x01,or ErrInvalidNamespace will be raised.
+	HashNamespace string
+	//HashFieldTTL support ttl features in hash mode with HEXPIRE,which requires redis 7.4+.
+	HashFieldTTL bool
 }
 
+//ErrClusterWithSentinel error raised if both cluster and sentinel mode are enabled
+var ErrClusterWithSentinel = errors.New("redisdb: cluster and sentinel mode can not be used together")
+
 func convertError(err error) error {
 	if err == nil {
 		return err
@@ -277,19 +709,152 @@ func convertError(err error) error {
 	return err
 }
 
+//CreateDriver create driver with config.
+//HashDriver will be returned if Hash is true.
 func (c *Config) CreateDriver() (kvdb.Driver, error) {
-	p := redispool.New()
-	err := c.Config.ApplyTo(p)
+	if c.Hash {
+		err := checkNamespace(c.HashNamespace)
+		if err != nil {
+			return nil, err
+		}
+	}
+	d, err := c.createDriver()
+	if err != nil {
+		return nil, err
+	}
+	if c.Hash {
+		return &HashDriver{
+			Driver:    d,
+			Namespace: c.HashNamespace,
+			FieldTTL:  c.HashFieldTTL,
+		}, nil
+	}
+	return d, nil
+}
+
+func (c *Config) createDriver() (*Driver, error) {
+	tlsconfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	newpool, err := c.poolCreator(tlsconfig)
 	if err != nil {
 		return nil, err
 	}
 	d := new()
 	d.Prefix = c.Prefix
 	d.NoMulti = c.NoMulti
-	d.Pool = p.Open()
+	d.UseScript = c.UseScript
+	d.Db = int(c.Db)
+	d.EnableNotifications = c.EnableNotifications
+	d.MaxKeyLength = c.MaxKeyLength
+	d.StoreOriginalKey = c.StoreOriginalKey
+	if c.NearCacheSize > 0 {
+		if c.Cluster {
+			return nil, ErrNearCacheWithCluster
+		}
+		//stale value read from replica after invalidation would be cached until next invalidation
+		if c.ReadFromReplicas {
+			return nil, ErrNearCacheWithReplicas
+		}
+		d.NearCache = NewNearCache(c.NearCacheSize)
+	}
+	if c.CircuitBreaker {
+		d.Breaker = NewBreaker()
+		if c.BreakerThreshold > 0 {
+			d.Breaker.Threshold = c.BreakerThreshold
+		}
+		if c.BreakerOpenTimeoutInSecond > 0 {
+			d.Breaker.OpenTimeout = time.Duration(c.BreakerOpenTimeoutInSecond) * time.Second
+		}
+	}
+	if c.Compression != "" {
+		d.Compressor, err = NewCompressor(c.Compression)
+		if err != nil {
+			return nil, err
+		}
+		d.Compressor.MinSize = c.CompressionMinSize
+	}
+	if c.Cluster && c.SentinelMasterName != "" {
+		return nil, ErrClusterWithSentinel
+	}
+	if c.SentinelMasterName != "" {
+		if len(c.SentinelAddresses) == 0 {
+			return nil, ErrNoSentinelMaster
+		}
+		d.Sentinel = NewSentinel(c.SentinelMasterName, c.SentinelAddresses, c.sentinelDialer(tlsconfig), newpool)
+		d.Sentinel.ReadFromReplicas = c.ReadFromReplicas
+		return d, nil
+	}
+	if c.Cluster {
+		if c.Db != 0 {
+			return nil, ErrClusterDb
+		}
+		seeds := []string{}
+		if c.Address != "" {
+			seeds = append(seeds, c.Address)
+		}
+		seeds = append(seeds, c.ClusterAddresses...)
+		if len(seeds) == 0 {
+			return nil, ErrNoClusterNode
+		}
+		d.Cluster = NewCluster(seeds, newpool)
+		return d, nil
+	}
+	d.Pool = newpool(c.Address)
 	return d, nil
 }
 
+func (c *Config) network() string {
+	if c.Network == "" {
+		return "tcp"
+	}
+	return c.Network
+}
+
+//poolCreator return function which creates connection pool for given address with other settings in config.
+//Pool will dial with TLS and ACL username options if configured.
+func (c *Config) poolCreator(tlsconfig *tls.Config) (func(addr string) *redis.Pool, error) {
+	err := c.Config.ApplyTo(redispool.New())
+	if err != nil {
+		return nil, err
+	}
+	opts := c.dialOptions(tlsconfig)
+	return func(addr string) *redis.Pool {
+		config := c.Config
+		config.Address = addr
+		p := redispool.New()
+		//Config is already validated,only address is changed.
+		config.ApplyTo(p)
+		pool := p.Open()
+		if opts != nil {
+			network := c.network()
+			pool.DialContext = nil
+			pool.Dial = func() (redis.Conn, error) {
+				return redis.Dial(network, addr, opts...)
+			}
+		}
+		return pool
+	}, nil
+}
+
+//sentinelDialer return function which dials connection to given sentinel address.
+func (c *Config) sentinelDialer(tlsconfig *tls.Config) func(addr string) (redis.Conn, error) {
+	opts := []redis.DialOption{
+		redis.DialPassword(c.SentinelPassword),
+		redis.DialConnectTimeout(time.Duration(c.ConnectTimeout) * time.Second),
+		redis.DialReadTimeout(time.Duration(c.ReadTimeoutInSecond) * time.Second),
+		redis.DialWriteTimeout(time.Duration(c.WriteTimeoutInSecond) * time.Second),
+	}
+	if tlsconfig != nil {
+		opts = append(opts, redis.DialUseTLS(true), redis.DialTLSConfig(c.sentinelTLSConfig(tlsconfig)))
+	}
+	network := c.network()
+	return func(addr string) (redis.Conn, error) {
+		return redis.Dial(network, addr, opts...)
+	}
+}
+
 //Factory driver factory
 func Factory(loader func(v interface{}) error) (kvdb.Driver, error) {
 	c := &Config{}
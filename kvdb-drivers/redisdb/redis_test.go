@@ -4,7 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/gomodule/redigo/redis"
+	"github.com/herb-go/herbdata"
+	"github.com/herb-go/herbdata-drivers/kvdb-drivers/internal/redisscan"
 	"github.com/herb-go/herbdata/kvdb"
 	"github.com/herb-go/herbdata/kvdb/featuretestutil"
 )
@@ -47,3 +51,380 @@ func TestDriverNo(t *testing.T) {
 	},
 		func(args ...interface{}) { fmt.Println(args...); panic("fatal") })
 }
+
+func newTestDriver(prefix string) *Driver {
+	c := &Config{}
+	err := json.Unmarshal([]byte(testConfig), c)
+	if err != nil {
+		panic(err)
+	}
+	c.Prefix = prefix
+	d, err := c.CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	return d.(*Driver)
+}
+
+func TestNext(t *testing.T) {
+	d := newTestDriver("test*[")
+	conn := d.Pool.Get()
+	_, err := conn.Do("FLUSHDB")
+	conn.Close()
+	if err != nil {
+		panic(err)
+	}
+	defer d.Close()
+	other := newTestDriver("test")
+	defer other.Close()
+	err = other.Set([]byte("other"), []byte("other"))
+	if err != nil {
+		panic(err)
+	}
+	_, err = d.IncreaseCounter([]byte("counter"), 1)
+	if err != nil {
+		panic(err)
+	}
+	expected := map[string]string{}
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key%d", i)
+		expected[key] = "value" + key
+		err = d.Set([]byte(key), []byte("value"+key))
+		if err != nil {
+			panic(err)
+		}
+	}
+	for _, limit := range []int{1, 3, 7, 100} {
+		result := map[string]string{}
+		var iter []byte
+		var data []*herbdata.KeyValue
+		for {
+			data, iter, err = d.Next(iter, limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) > limit {
+				t.Fatal(len(data), limit)
+			}
+			//SCAN order is not byte order,so only check the returned key set
+			for _, v := range data {
+				result[string(v.Key)] = string(v.Value)
+			}
+			if len(iter) == 0 {
+				break
+			}
+		}
+		if len(result) != len(expected) {
+			t.Fatal(limit, len(result))
+		}
+		for k, v := range expected {
+			if result[k] != v {
+				t.Fatal(limit, k, result[k])
+			}
+		}
+	}
+	_, _, err = d.Next([]byte("invalid"), 1)
+	if err != ErrInvalidIter {
+		t.Fatal(err)
+	}
+}
+
+func TestNextResume(t *testing.T) {
+	d := newTestDriver("testresume")
+	conn := d.Pool.Get()
+	_, err := conn.Do("FLUSHDB")
+	conn.Close()
+	if err != nil {
+		panic(err)
+	}
+	defer d.Close()
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		err = d.Set([]byte(key), []byte(key))
+		if err != nil {
+			panic(err)
+		}
+	}
+	result := map[string]bool{}
+	data, iter, err := d.Next(nil, 3)
+	if err != nil || len(iter) == 0 {
+		t.Fatal(err, iter)
+	}
+	//keys already returned are deleted and new keys are added before resuming
+	for _, v := range data {
+		result[string(v.Key)] = true
+		err = d.Delete(v.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = d.Set([]byte("new"+string(v.Key)), []byte("new"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for len(iter) != 0 {
+		data, iter, err = d.Next(iter, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range data {
+			if result[string(v.Key)] {
+				t.Fatal(string(v.Key))
+			}
+			result[string(v.Key)] = true
+		}
+	}
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if !result[key] {
+			t.Fatal(key)
+		}
+	}
+	_, _, err = d.Next(redisscan.EncodeIter("0", []string{"otherprefix"}, ""), 3)
+	if err != ErrInvalidIter {
+		t.Fatal(err)
+	}
+}
+
+func TestDriverNoMultiScript(t *testing.T) {
+	featuretestutil.TestDriver(func() kvdb.Driver {
+		c := &Config{}
+		err := json.Unmarshal([]byte(testConfig), c)
+		if err != nil {
+			panic(err)
+		}
+		c.NoMulti = true
+		c.UseScript = true
+		d, err := c.CreateDriver()
+		if err != nil {
+			panic(err)
+		}
+		conn := (d.(*Driver)).Pool.Get()
+		defer conn.Close()
+		conn.Send("FLUSHDB")
+		return d
+	},
+		func(args ...interface{}) { fmt.Println(args...); panic("fatal") })
+}
+
+func TestIncreaseCounterWithTTLScript(t *testing.T) {
+	d := newTestDriver("")
+	defer d.Close()
+	d.NoMulti = true
+	if d.Features()&kvdb.FeatureTTLCounter != 0 {
+		t.Fatal(d.Features())
+	}
+	d.UseScript = true
+	if d.Features()&kvdb.FeatureTTLCounter == 0 {
+		t.Fatal(d.Features())
+	}
+	conn := d.Pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("FLUSHDB")
+	if err != nil {
+		panic(err)
+	}
+	//Script is not loaded,EVAL should be used.
+	_, err = conn.Do("SCRIPT", "FLUSH")
+	if err != nil {
+		panic(err)
+	}
+	v, err := d.IncreaseCounterWithTTL([]byte("counter"), 2, 100)
+	if err != nil || v != 2 {
+		t.Fatal(v, err)
+	}
+	v, err = d.IncreaseCounterWithTTL([]byte("counter"), 3, 200)
+	if err != nil || v != 5 {
+		t.Fatal(v, err)
+	}
+	ttl, err := redis.Int64(conn.Do("TTL", d.getCounterKey([]byte("counter"))))
+	if err != nil || ttl <= 100 || ttl > 200 {
+		t.Fatal(ttl, err)
+	}
+	_, err = conn.Do("SET", d.getCounterKey([]byte("counter")), "notnumber")
+	if err != nil {
+		panic(err)
+	}
+	_, err = d.IncreaseCounterWithTTL([]byte("counter"), 1, 100)
+	if err == nil {
+		t.Fatal(err)
+	}
+}
+
+func flushTestDriver(d *Driver) {
+	conn := d.Pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("FLUSHDB")
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	d := newTestDriver("expire")
+	defer d.Close()
+	flushTestDriver(d)
+	err := d.SetWithTTL([]byte("set"), []byte("value"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := d.InsertWithTTL([]byte("insert"), []byte("value"), 1)
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	err = d.Set([]byte("update"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err = d.UpdateWithTTL([]byte("update"), []byte("value"), 1)
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	err = d.SetCounterWithTTL([]byte("setcounter"), 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.IncreaseCounterWithTTL([]byte("increasecounter"), 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.SetWithTTL([]byte("notexpired"), []byte("value"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Set([]byte("persisted"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fastForward(2 * time.Second)
+	for _, v := range []string{"set", "insert", "update"} {
+		_, err = d.Get([]byte(v))
+		if err != herbdata.ErrNotFound {
+			t.Fatal(v, err)
+		}
+	}
+	for _, v := range []string{"setcounter", "increasecounter"} {
+		c, err := d.GetCounter([]byte(v))
+		if err != nil || c != 0 {
+			t.Fatal(v, c, err)
+		}
+	}
+	for _, v := range []string{"notexpired", "persisted"} {
+		data, err := d.Get([]byte(v))
+		if err != nil || string(data) != "value" {
+			t.Fatal(v, string(data), err)
+		}
+	}
+	//expired key can be inserted again
+	ok, err = d.Insert([]byte("set"), []byte("value"))
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+}
+
+func TestInsertUpdate(t *testing.T) {
+	d := newTestDriver("insertupdate")
+	defer d.Close()
+	flushTestDriver(d)
+	ok, err := d.Update([]byte("key"), []byte("update"))
+	if ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	ok, err = d.UpdateWithTTL([]byte("key"), []byte("update"), 100)
+	if ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	_, err = d.Get([]byte("key"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	ok, err = d.Insert([]byte("key"), []byte("insert"))
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	ok, err = d.Insert([]byte("key"), []byte("insert2"))
+	if ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	ok, err = d.InsertWithTTL([]byte("key"), []byte("insert3"), 100)
+	if ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	data, err := d.Get([]byte("key"))
+	if err != nil || string(data) != "insert" {
+		t.Fatal(string(data), err)
+	}
+	ok, err = d.UpdateWithTTL([]byte("key"), []byte("update"), 100)
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	ttl, err := d.TTL([]byte("key"))
+	if err != nil || ttl <= 90*time.Second {
+		t.Fatal(ttl, err)
+	}
+	//update without ttl removes ttl as SET does
+	ok, err = d.Update([]byte("key"), []byte("update2"))
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	ttl, err = d.TTL([]byte("key"))
+	if err != nil || ttl != NoExpiry {
+		t.Fatal(ttl, err)
+	}
+	data, err = d.Get([]byte("key"))
+	if err != nil || string(data) != "update2" {
+		t.Fatal(string(data), err)
+	}
+	//counter with same key is not affected
+	ok, err = d.Update([]byte("counter"), []byte("update"))
+	if ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	_, err = d.IncreaseCounter([]byte("counter"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err = d.Insert([]byte("counter"), []byte("insert"))
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+}
+
+func TestIncreaseCounterWithTTLMulti(t *testing.T) {
+	d := newTestDriver("multi")
+	defer d.Close()
+	flushTestDriver(d)
+	v, err := d.IncreaseCounterWithTTL([]byte("counter"), 2, 100)
+	if err != nil || v != 2 {
+		t.Fatal(v, err)
+	}
+	v, err = d.IncreaseCounterWithTTL([]byte("counter"), -3, 200)
+	if err != nil || v != -1 {
+		t.Fatal(v, err)
+	}
+	ttl, err := d.CounterTTL([]byte("counter"))
+	if err != nil || ttl <= 100*time.Second || ttl > 200*time.Second {
+		t.Fatal(ttl, err)
+	}
+	conn := d.Pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("SET", d.getCounterKey([]byte("counter")), "notnumber")
+	if err != nil {
+		panic(err)
+	}
+	//EXPIRE in transaction is still executed after INCRBY failed.
+	_, err = d.IncreaseCounterWithTTL([]byte("counter"), 1, 300)
+	if err == nil {
+		t.Fatal(err)
+	}
+	//connection should not be left in transaction
+	v, err = d.IncreaseCounterWithTTL([]byte("counter2"), 1, 100)
+	if err != nil || v != 1 {
+		t.Fatal(v, err)
+	}
+	d.NoMulti = true
+	_, err = d.IncreaseCounterWithTTL([]byte("counter"), 1, 100)
+	if err != kvdb.ErrFeatureNotSupported {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,336 @@
+package redisdb
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//ErrNoSentinelMaster error raised if no sentinel can resolve master address
+var ErrNoSentinelMaster = errors.New("redisdb: no sentinel master available")
+
+//DefaultSentinelRetryInterval default interval to wait before resubscribing sentinel events
+var DefaultSentinelRetryInterval = time.Second
+
+func defaultErrHandler(err error) {
+	log.Println(err)
+}
+
+//Sentinel redis sentinel client.
+//Sentinel resolves current master and replicas,and rebuilds connection pools on failover.
+type Sentinel struct {
+	//MasterName name of master monitored by sentinels.
+	MasterName string
+	//Addresses sentinel addresses.
+	Addresses []string
+	//DialSentinel dial connection to given sentinel address.
+	DialSentinel func(addr string) (redis.Conn, error)
+	//NewPool create connection pool for given master or replica address.
+	NewPool func(addr string) *redis.Pool
+	//ReadFromReplicas send read commands to replicas if any.
+	ReadFromReplicas bool
+	//RetryInterval interval to wait before resubscribing sentinel events.
+	RetryInterval time.Duration
+	//ErrHandler handler for errors raised when watching sentinel events.
+	ErrHandler   func(error)
+	lock         sync.RWMutex
+	master       string
+	masterPool   *redis.Pool
+	replicas     []string
+	replicaPools []*redis.Pool
+	next         uint64
+	stopped      chan struct{}
+	watching     redis.Conn
+}
+
+//NewSentinel create new sentinel with given master name,sentinel addresses,sentinel dialer and pool creator.
+func NewSentinel(name string, addrs []string, dial func(addr string) (redis.Conn, error), newpool func(addr string) *redis.Pool) *Sentinel {
+	return &Sentinel{
+		MasterName:    name,
+		Addresses:     addrs,
+		DialSentinel:  dial,
+		NewPool:       newpool,
+		RetryInterval: DefaultSentinelRetryInterval,
+		ErrHandler:    defaultErrHandler,
+	}
+}
+
+func (s *Sentinel) dial() (redis.Conn, error) {
+	var err error
+	for _, addr := range s.Addresses {
+		var conn redis.Conn
+		conn, err = s.DialSentinel(addr)
+		if err == nil {
+			return conn, nil
+		}
+	}
+	if err == nil {
+		return nil, ErrNoSentinelMaster
+	}
+	return nil, err
+}
+
+func (s *Sentinel) query(conn redis.Conn) (master string, replicas []string, err error) {
+	addr, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", s.MasterName))
+	if err == redis.ErrNil {
+		return "", nil, ErrNoSentinelMaster
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if len(addr) != 2 {
+		return "", nil, ErrNoSentinelMaster
+	}
+	master = net.JoinHostPort(addr[0], addr[1])
+	if !s.ReadFromReplicas {
+		return master, nil, nil
+	}
+	list, err := redis.Values(conn.Do("SENTINEL", "replicas", s.MasterName))
+	if err != nil {
+		return "", nil, err
+	}
+	for _, v := range list {
+		info, err := redis.StringMap(v, nil)
+		if err != nil {
+			return "", nil, err
+		}
+		if strings.Contains(info["flags"], "down") || strings.Contains(info["flags"], "disconnected") {
+			continue
+		}
+		replicas = append(replicas, net.JoinHostPort(info["ip"], info["port"]))
+	}
+	return master, replicas, nil
+}
+
+//Refresh resolve master and replicas from sentinels and rebuild pools if changed.
+//Return any error if raised.
+func (s *Sentinel) Refresh() error {
+	var err error
+	for _, addr := range s.Addresses {
+		var conn redis.Conn
+		conn, err = s.DialSentinel(addr)
+		if err != nil {
+			continue
+		}
+		var master string
+		var replicas []string
+		master, replicas, err = s.query(conn)
+		conn.Close()
+		if err == nil {
+			s.update(master, replicas)
+			return nil
+		}
+	}
+	if err == nil {
+		return ErrNoSentinelMaster
+	}
+	return err
+}
+
+func (s *Sentinel) update(master string, replicas []string) {
+	var closing []*redis.Pool
+	s.lock.Lock()
+	if master != s.master {
+		if s.masterPool != nil {
+			closing = append(closing, s.masterPool)
+		}
+		s.master = master
+		s.masterPool = s.NewPool(master)
+	}
+	if strings.Join(replicas, ",") != strings.Join(s.replicas, ",") {
+		closing = append(closing, s.replicaPools...)
+		s.replicas = replicas
+		s.replicaPools = make([]*redis.Pool, len(replicas))
+		for k := range replicas {
+			s.replicaPools[k] = s.NewPool(replicas[k])
+		}
+	}
+	s.lock.Unlock()
+	for _, v := range closing {
+		v.Close()
+	}
+}
+
+//Master return current master address.
+func (s *Sentinel) Master() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.master
+}
+
+//Replicas return current replica addresses.
+func (s *Sentinel) Replicas() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]string{}, s.replicas...)
+}
+
+//Get get connection to current master.
+//Master will be resolved if not resolved yet.
+func (s *Sentinel) Get() redis.Conn {
+	s.lock.RLock()
+	p := s.masterPool
+	s.lock.RUnlock()
+	if p == nil {
+		err := s.Refresh()
+		if err != nil {
+			return errorConn{err: err}
+		}
+		s.lock.RLock()
+		p = s.masterPool
+		s.lock.RUnlock()
+	}
+	return p.Get()
+}
+
+//dialMaster dial new connection to current master,which is not managed by pool.
+//Master will be resolved if not resolved yet.
+func (s *Sentinel) dialMaster() (redis.Conn, error) {
+	s.lock.RLock()
+	p := s.masterPool
+	s.lock.RUnlock()
+	if p == nil {
+		err := s.Refresh()
+		if err != nil {
+			return nil, err
+		}
+		s.lock.RLock()
+		p = s.masterPool
+		s.lock.RUnlock()
+	}
+	return dialPool(p)
+}
+
+//GetReplica get connection to one of replicas in round robin.
+//Connection to master will be returned if ReadFromReplicas is false or no replica available.
+func (s *Sentinel) GetReplica() redis.Conn {
+	if s.ReadFromReplicas {
+		s.lock.RLock()
+		pools := s.replicaPools
+		s.lock.RUnlock()
+		if len(pools) > 0 {
+			n := atomic.AddUint64(&s.next, 1)
+			return pools[n%uint64(len(pools))].Get()
+		}
+	}
+	return s.Get()
+}
+
+//Start resolve master and start watching failover events published by sentinels.
+//Return any error if raised.
+func (s *Sentinel) Start() error {
+	err := s.Refresh()
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.stopped = make(chan struct{})
+	s.lock.Unlock()
+	go s.watch(s.stopped)
+	return nil
+}
+
+func (s *Sentinel) watch(stopped chan struct{}) {
+	for {
+		err := s.subscribe(stopped)
+		select {
+		case <-stopped:
+			return
+		default:
+		}
+		if err != nil {
+			s.ErrHandler(err)
+		}
+		select {
+		case <-stopped:
+			return
+		case <-time.After(s.RetryInterval):
+		}
+	}
+}
+
+func (s *Sentinel) subscribe(stopped chan struct{}) error {
+	conn, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	s.lock.Lock()
+	select {
+	case <-stopped:
+		s.lock.Unlock()
+		return nil
+	default:
+	}
+	s.watching = conn
+	s.lock.Unlock()
+	psc := redis.PubSubConn{Conn: conn}
+	err = psc.Subscribe("+switch-master", "+slave", "+sdown", "-sdown")
+	if err != nil {
+		return err
+	}
+	//Failover may happen while not subscribed.
+	err = s.Refresh()
+	if err != nil {
+		s.ErrHandler(err)
+	}
+	for {
+		switch v := psc.ReceiveWithTimeout(0).(type) {
+		case redis.Message:
+			if s.concerned(string(v.Data)) {
+				err = s.Refresh()
+				if err != nil {
+					s.ErrHandler(err)
+				}
+			}
+		case error:
+			return v
+		}
+	}
+}
+
+//concerned check if sentinel event payload is about watched master.
+func (s *Sentinel) concerned(payload string) bool {
+	for _, v := range strings.Fields(payload) {
+		if v == s.MasterName {
+			return true
+		}
+	}
+	return false
+}
+
+//Close stop watching sentinel events and close all pools.
+func (s *Sentinel) Close() error {
+	s.lock.Lock()
+	if s.stopped != nil {
+		close(s.stopped)
+		s.stopped = nil
+	}
+	if s.watching != nil {
+		s.watching.Close()
+		s.watching = nil
+	}
+	pools := append([]*redis.Pool{}, s.replicaPools...)
+	if s.masterPool != nil {
+		pools = append(pools, s.masterPool)
+	}
+	s.master = ""
+	s.masterPool = nil
+	s.replicas = nil
+	s.replicaPools = nil
+	s.lock.Unlock()
+	var result error
+	for _, v := range pools {
+		err := v.Close()
+		if err != nil {
+			result = err
+		}
+	}
+	return result
+}
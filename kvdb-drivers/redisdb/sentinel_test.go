@@ -0,0 +1,308 @@
+package redisdb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/herb-go/herbdata"
+	"github.com/herb-go/herbdata/kvdb"
+)
+
+//fakeSentinel in-process sentinel which serves master and replicas running on miniredis
+type fakeSentinel struct {
+	lock        sync.Mutex
+	server      *server.Server
+	password    string
+	name        string
+	master      *miniredis.Miniredis
+	replicas    []*miniredis.Miniredis
+	subscribers []*server.Peer
+}
+
+func newFakeSentinel(name string, password string, master *miniredis.Miniredis, replicas ...*miniredis.Miniredis) *fakeSentinel {
+	srv, err := server.NewServer("127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := &fakeSentinel{
+		server:   srv,
+		password: password,
+		name:     name,
+		master:   master,
+		replicas: replicas,
+	}
+	srv.Register("AUTH", s.auth)
+	srv.Register("PING", func(c *server.Peer, cmd string, args []string) {
+		c.WriteInline("PONG")
+	})
+	srv.Register("SENTINEL", s.sentinel)
+	srv.Register("SUBSCRIBE", s.subscribe)
+	return s
+}
+
+func (s *fakeSentinel) Addr() string {
+	return s.server.Addr().String()
+}
+
+func (s *fakeSentinel) authed(c *server.Peer) bool {
+	if s.password != "" && c.Ctx != "authed" {
+		c.WriteError("NOAUTH Authentication required.")
+		return false
+	}
+	return true
+}
+
+func (s *fakeSentinel) auth(c *server.Peer, cmd string, args []string) {
+	if len(args) != 1 || args[0] != s.password {
+		c.WriteError("ERR invalid password")
+		return
+	}
+	c.Ctx = "authed"
+	c.WriteOK()
+}
+
+func (s *fakeSentinel) sentinel(c *server.Peer, cmd string, args []string) {
+	if !s.authed(c) {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(args) != 2 || args[1] != s.name {
+		c.WriteNull()
+		return
+	}
+	switch strings.ToLower(args[0]) {
+	case "get-master-addr-by-name":
+		c.WriteStrings([]string{s.master.Host(), s.master.Port()})
+	case "replicas", "slaves":
+		c.WriteLen(len(s.replicas))
+		for _, v := range s.replicas {
+			c.WriteStrings([]string{"ip", v.Host(), "port", v.Port(), "flags", "slave"})
+		}
+	default:
+		c.WriteError("ERR unknown sentinel subcommand")
+	}
+}
+
+func (s *fakeSentinel) subscribe(c *server.Peer, cmd string, args []string) {
+	if !s.authed(c) {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for k, v := range args {
+		c.WriteLen(3)
+		c.WriteBulk("subscribe")
+		c.WriteBulk(v)
+		c.WriteInt(k + 1)
+	}
+	s.subscribers = append(s.subscribers, c)
+}
+
+//failover promote first replica to master and publish +switch-master event.
+func (s *fakeSentinel) failover() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	old := s.master
+	s.master = s.replicas[0]
+	s.replicas = []*miniredis.Miniredis{old}
+	payload := strings.Join([]string{s.name, old.Host(), old.Port(), s.master.Host(), s.master.Port()}, " ")
+	for _, c := range s.subscribers {
+		c.Block(func(w *server.Writer) {
+			w.WriteLen(3)
+			w.WriteBulk("message")
+			w.WriteBulk("+switch-master")
+			w.WriteBulk(payload)
+		})
+		c.Flush()
+	}
+}
+
+func (s *fakeSentinel) Close() {
+	s.server.Close()
+}
+
+func newTestSentinelDriver(addr string, readFromReplicas bool) *Driver {
+	c := &Config{}
+	c.Network = "tcp"
+	c.MaxIdle = 10
+	c.Prefix = "sentinel"
+	c.SentinelMasterName = "mymaster"
+	c.SentinelAddresses = []string{"127.0.0.1:1", addr}
+	c.SentinelPassword = "sentinelpassword"
+	c.ReadFromReplicas = readFromReplicas
+	d, err := c.CreateDriver()
+	if err != nil {
+		panic(err)
+	}
+	driver := d.(*Driver)
+	driver.Sentinel.RetryInterval = 10 * time.Millisecond
+	driver.Sentinel.ErrHandler = func(error) {}
+	return driver
+}
+
+func TestSentinel(t *testing.T) {
+	master := miniredis.RunT(t)
+	replica := miniredis.RunT(t)
+	s := newFakeSentinel("mymaster", "sentinelpassword", master, replica)
+	defer s.Close()
+	d := newTestSentinelDriver(s.Addr(), false)
+	err := d.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if d.Sentinel.Master() != master.Addr() {
+		t.Fatal(d.Sentinel.Master())
+	}
+	err = d.Set([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := master.Get(d.getKey([]byte("key")))
+	if err != nil || data != "value" {
+		t.Fatal(data, err)
+	}
+	if replica.Exists(d.getKey([]byte("key"))) {
+		t.Fatal(replica.Keys())
+	}
+	s.failover()
+	deadline := time.Now().Add(5 * time.Second)
+	for d.Sentinel.Master() != replica.Addr() {
+		if time.Now().After(deadline) {
+			t.Fatal(d.Sentinel.Master())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	err = d.Set([]byte("key2"), []byte("value2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = replica.Get(d.getKey([]byte("key2")))
+	if err != nil || data != "value2" {
+		t.Fatal(data, err)
+	}
+}
+
+func TestSentinelReadFromReplicas(t *testing.T) {
+	master := miniredis.RunT(t)
+	replica := miniredis.RunT(t)
+	s := newFakeSentinel("mymaster", "sentinelpassword", master, replica)
+	defer s.Close()
+	d := newTestSentinelDriver(s.Addr(), true)
+	err := d.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if len(d.Sentinel.Replicas()) != 1 || d.Sentinel.Replicas()[0] != replica.Addr() {
+		t.Fatal(d.Sentinel.Replicas())
+	}
+	err = d.Set([]byte("key"), []byte("master"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.Get([]byte("key"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	replica.Set(d.getKey([]byte("key")), "replica")
+	data, err := d.Get([]byte("key"))
+	if err != nil || string(data) != "replica" {
+		t.Fatal(string(data), err)
+	}
+}
+
+func TestSentinelNextWithReplicas(t *testing.T) {
+	master := miniredis.RunT(t)
+	replicas := []*miniredis.Miniredis{miniredis.RunT(t), miniredis.RunT(t)}
+	s := newFakeSentinel("mymaster", "sentinelpassword", master, replicas...)
+	defer s.Close()
+	d := newTestSentinelDriver(s.Addr(), true)
+	err := d.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if len(d.Sentinel.Replicas()) != 2 {
+		t.Fatal(d.Sentinel.Replicas())
+	}
+	expected := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		err = d.Set([]byte(key), []byte("value"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected[key] = true
+	}
+	//replicas hold different keys,so cursors issued by one replica can not be resumed on the other
+	for i, r := range replicas {
+		for j := 0; j < 20; j++ {
+			r.Set(d.getKey([]byte(fmt.Sprintf("replica%d-%02d", i, j))), "value")
+		}
+	}
+	h := &HashDriver{Driver: d, Namespace: "hash"}
+	for i := 0; i < 30; i++ {
+		err = h.Set([]byte(fmt.Sprintf("field%02d", i)), []byte("value"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, r := range replicas {
+		r.HSet(h.getHashKey(), h.getField([]byte("replicafield")), "value")
+	}
+	walk := func(driver kvdb.Driver) map[string]bool {
+		keys := map[string]bool{}
+		var iter []byte
+		for {
+			kvs, newiter, err := driver.Next(iter, 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range kvs {
+				if keys[string(v.Key)] {
+					t.Fatal(string(v.Key))
+				}
+				keys[string(v.Key)] = true
+			}
+			if len(newiter) == 0 {
+				return keys
+			}
+			iter = newiter
+		}
+	}
+	keys := walk(d)
+	if len(keys) != len(expected) {
+		t.Fatal(len(keys))
+	}
+	for k := range keys {
+		if !expected[k] {
+			t.Fatal(k)
+		}
+	}
+	fields := walk(h)
+	if len(fields) != 30 || fields["replicafield"] {
+		t.Fatal(len(fields))
+	}
+}
+
+func TestSentinelWrongPassword(t *testing.T) {
+	master := miniredis.RunT(t)
+	s := newFakeSentinel("mymaster", "otherpassword", master)
+	defer s.Close()
+	d := newTestSentinelDriver(s.Addr(), false)
+	err := d.Start()
+	if err == nil {
+		t.Fatal(err)
+	}
+	err = d.Set([]byte("key"), []byte("value"))
+	if err == nil {
+		t.Fatal(err)
+	}
+}
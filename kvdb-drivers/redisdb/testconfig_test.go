@@ -0,0 +1,77 @@
+package redisdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+//testConfigEnv environment variable of json config used to run tests against a real redis server.
+//Tests run against an in-process miniredis if it is empty.
+//For example:
+//
+//	REDISDB_TESTCONFIG='{"Network":"tcp","Address":"127.0.0.1:6379","Password":"123456","MaxIdle":100}' go test
+//
+//Tests will flush the configured db.
+const testConfigEnv = "REDISDB_TESTCONFIG"
+
+var testConfig string
+
+//testServer in-process redis server used if testConfigEnv is not set.
+var testServer *miniredis.Miniredis
+
+//testClockInterval interval to move clock of testServer forward,so that keys expire as on a real server.
+const testClockInterval = 50 * time.Millisecond
+
+func TestMain(m *testing.M) {
+	testConfig = os.Getenv(testConfigEnv)
+	if testConfig != "" {
+		os.Exit(m.Run())
+	}
+	var err error
+	testServer, err = miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	testServer.RequireAuth("123456")
+	testConfig = fmt.Sprintf(`{
+            "Network": "tcp",
+            "Address": %q,
+            "Password": "123456",
+            "Db": 0,
+            "ConnectTimeout": 60,
+            "ReadTimeoutInSecond": 60,
+            "WriteTimeoutInSecond": 60,
+            "MaxIdle": 100,
+            "MaxAlive": 200,
+            "IdleTimeoutInSecond": 60
+        }`, testServer.Addr())
+	stopped := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stopped:
+				return
+			case <-time.After(testClockInterval):
+				testServer.FastForward(testClockInterval)
+			}
+		}
+	}()
+	code := m.Run()
+	close(stopped)
+	testServer.Close()
+	os.Exit(code)
+}
+
+//fastForward wait until given duration passed for test server.
+//Clock of in-process server is moved forward directly.
+func fastForward(d time.Duration) {
+	if testServer != nil {
+		testServer.FastForward(d)
+		return
+	}
+	time.Sleep(d)
+}
@@ -0,0 +1,73 @@
+package redisdb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//ErrInvalidTLSCA error raised if no certificate can be loaded from TLSCAFile
+var ErrInvalidTLSCA = errors.New("redisdb: invalid tls ca file")
+
+//TLSConfig create tls config from config.
+//Return nil if TLS is not enabled,and any error if raised.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	if !c.TLS {
+		return nil, nil
+	}
+	config := &tls.Config{
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: c.TLSInsecureSkipVerify,
+	}
+	if c.TLSCAFile != "" {
+		data, err := ioutil.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, ErrInvalidTLSCA
+		}
+		config.RootCAs = pool
+	}
+	if c.TLSCertFile != "" || c.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+//sentinelTLSConfig create tls config used to connect sentinels from given redis tls config.
+//Server name is replaced with SentinelTLSServerName,as sentinels run on different hosts from master.
+func (c *Config) sentinelTLSConfig(tlsconfig *tls.Config) *tls.Config {
+	config := tlsconfig.Clone()
+	config.ServerName = c.SentinelTLSServerName
+	return config
+}
+
+//dialOptions create dial options for given tls config and ACL username.
+//Return nil if neither TLS nor Username is configured.
+func (c *Config) dialOptions(tlsconfig *tls.Config) []redis.DialOption {
+	if tlsconfig == nil && c.Username == "" {
+		return nil
+	}
+	opts := []redis.DialOption{
+		redis.DialUsername(c.Username),
+		redis.DialPassword(c.Password),
+		redis.DialDatabase(c.Db),
+		redis.DialConnectTimeout(time.Duration(c.ConnectTimeout) * time.Second),
+		redis.DialReadTimeout(time.Duration(c.ReadTimeoutInSecond) * time.Second),
+		redis.DialWriteTimeout(time.Duration(c.WriteTimeoutInSecond) * time.Second),
+	}
+	if tlsconfig != nil {
+		opts = append(opts, redis.DialUseTLS(true), redis.DialTLSConfig(tlsconfig))
+	}
+	return opts
+}
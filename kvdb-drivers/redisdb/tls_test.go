@@ -0,0 +1,240 @@
+package redisdb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/herb-go/herbdata/kvdb"
+	"github.com/herb-go/herbdata/kvdb/featuretestutil"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(template *x509.Certificate, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	signer, signkey := template, key
+	if parent != nil {
+		signer, signkey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signkey)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func (c *testCert) writeTo(dir string, name string) (certfile string, keyfile string) {
+	certfile = filepath.Join(dir, name+".crt")
+	keyfile = filepath.Join(dir, name+".key")
+	err := ioutil.WriteFile(certfile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600)
+	if err != nil {
+		panic(err)
+	}
+	keyder, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		panic(err)
+	}
+	err = ioutil.WriteFile(keyfile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyder}), 0600)
+	if err != nil {
+		panic(err)
+	}
+	return certfile, keyfile
+}
+
+type tlsTestEnv struct {
+	server   *miniredis.Miniredis
+	dir      string
+	cafile   string
+	certfile string
+	keyfile  string
+}
+
+//newTLSTestEnv start a TLS-terminating miniredis which requires client certificate and ACL user.
+func newTLSTestEnv() *tlsTestEnv {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	notbefore := time.Now().Add(-time.Hour)
+	notafter := time.Now().Add(time.Hour)
+	ca := newTestCert(&x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             notbefore,
+		NotAfter:              notafter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	server := newTestCert(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "redis.test"},
+		DNSNames:     []string{"redis.test"},
+		NotBefore:    notbefore,
+		NotAfter:     notafter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	client := newTestCert(&x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    notbefore,
+		NotAfter:     notafter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	cas := x509.NewCertPool()
+	cas.AddCert(ca.cert)
+	env := &tlsTestEnv{dir: dir}
+	env.cafile, _ = ca.writeTo(dir, "ca")
+	env.certfile, env.keyfile = client.writeTo(dir, "client")
+	env.server, err = miniredis.RunTLS(&tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate()},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    cas,
+	})
+	if err != nil {
+		panic(err)
+	}
+	env.server.RequireUserAuth("user", "password")
+	return env
+}
+
+func (e *tlsTestEnv) Config() *Config {
+	c := &Config{}
+	c.Network = "tcp"
+	c.Address = e.server.Addr()
+	c.MaxIdle = 10
+	c.Username = "user"
+	c.Password = "password"
+	c.TLS = true
+	c.TLSCAFile = e.cafile
+	c.TLSCertFile = e.certfile
+	c.TLSKeyFile = e.keyfile
+	c.TLSServerName = "redis.test"
+	return c
+}
+
+func (e *tlsTestEnv) Close() {
+	e.server.Close()
+	os.RemoveAll(e.dir)
+}
+
+func TestTLS(t *testing.T) {
+	env := newTLSTestEnv()
+	defer env.Close()
+	featuretestutil.TestDriver(func() kvdb.Driver {
+		d, err := env.Config().CreateDriver()
+		if err != nil {
+			panic(err)
+		}
+		return d
+	},
+		func(args ...interface{}) { fmt.Println(args...); panic("fatal") })
+}
+
+func TestTLSFail(t *testing.T) {
+	env := newTLSTestEnv()
+	defer env.Close()
+	var tests = []func(c *Config){
+		//server certificate is issued to redis.test
+		func(c *Config) { c.TLSServerName = "" },
+		func(c *Config) { c.TLSCertFile, c.TLSKeyFile = "", "" },
+		func(c *Config) { c.TLSCAFile = "" },
+		func(c *Config) { c.Username = "" },
+		func(c *Config) { c.Username = "other" },
+		func(c *Config) { c.TLS = false },
+	}
+	for k, v := range tests {
+		c := env.Config()
+		v(c)
+		d, err := c.CreateDriver()
+		if err != nil {
+			t.Fatal(k, err)
+		}
+		err = d.Set([]byte("key"), []byte("value"))
+		if err == nil {
+			t.Fatal(k, err)
+		}
+		d.Close()
+	}
+	c := env.Config()
+	c.TLSInsecureSkipVerify = true
+	c.TLSServerName = ""
+	c.TLSCAFile = ""
+	d, err := c.CreateDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	err = d.Set([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	env := newTLSTestEnv()
+	defer env.Close()
+	c := env.Config()
+	c.TLS = false
+	tlsconfig, err := c.TLSConfig()
+	if tlsconfig != nil || err != nil {
+		t.Fatal(tlsconfig, err)
+	}
+	c = env.Config()
+	c.TLSServerName = "master"
+	tlsconfig, err = c.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sentinelconfig := c.sentinelTLSConfig(tlsconfig)
+	if sentinelconfig.ServerName != "" || tlsconfig.ServerName != "master" || sentinelconfig.RootCAs != tlsconfig.RootCAs {
+		t.Fatal(sentinelconfig.ServerName, tlsconfig.ServerName)
+	}
+	c.SentinelTLSServerName = "sentinel"
+	sentinelconfig = c.sentinelTLSConfig(tlsconfig)
+	if sentinelconfig.ServerName != "sentinel" {
+		t.Fatal(sentinelconfig.ServerName)
+	}
+	c = env.Config()
+	c.TLSCAFile = env.keyfile
+	_, err = c.CreateDriver()
+	if err != ErrInvalidTLSCA {
+		t.Fatal(err)
+	}
+	c = env.Config()
+	c.TLSKeyFile = env.cafile
+	_, err = c.CreateDriver()
+	if err == nil {
+		t.Fatal(err)
+	}
+}
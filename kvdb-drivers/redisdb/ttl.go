@@ -0,0 +1,122 @@
+package redisdb
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/herb-go/herbdata"
+)
+
+//NoExpiry ttl returned by TTL and CounterTTL if key exists but has no associated expiry.
+const NoExpiry = time.Duration(-1)
+
+//TTLDriver driver which supports querying and refreshing ttl of existing keys.
+//Callers can detect ttl support by type assertion.
+type TTLDriver interface {
+	//TTL return remaining ttl of value with given key.
+	TTL(key []byte) (time.Duration, error)
+	//Expire set ttl in second of value with given key.
+	Expire(key []byte, ttlInSecond int64) error
+	//Persist remove ttl of value with given key.
+	Persist(key []byte) error
+	//CounterTTL return remaining ttl of counter with given key.
+	CounterTTL(key []byte) (time.Duration, error)
+	//ExpireCounter set ttl in second of counter with given key.
+	ExpireCounter(key []byte, ttlInSecond int64) error
+	//PersistCounter remove ttl of counter with given key.
+	PersistCounter(key []byte) error
+}
+
+var _ TTLDriver = &Driver{}
+
+//TTL return remaining ttl of value with given key.
+//Return NoExpiry if value has no ttl,
+//and herbdata.ErrNotFound if value not found.
+func (d *Driver) TTL(key []byte) (time.Duration, error) {
+	return d.pttl(d.getKey(key))
+}
+
+//Expire set ttl in second of value with given key.
+//Value will expire ttlInSecond seconds later no matter what ttl it had.
+//Return herbdata.ErrNotFound if value not found.
+func (d *Driver) Expire(key []byte, ttlInSecond int64) error {
+	return d.expire(d.getKey(key), ttlInSecond)
+}
+
+//Persist remove ttl of value with given key.
+//Return herbdata.ErrNotFound if value not found.
+func (d *Driver) Persist(key []byte) error {
+	return d.persist(d.getKey(key))
+}
+
+//CounterTTL return remaining ttl of counter with given key.
+//Return NoExpiry if counter has no ttl,
+//and herbdata.ErrNotFound if counter not found.
+func (d *Driver) CounterTTL(key []byte) (time.Duration, error) {
+	return d.pttl(d.getCounterKey(key))
+}
+
+//ExpireCounter set ttl in second of counter with given key.
+//Return herbdata.ErrNotFound if counter not found.
+func (d *Driver) ExpireCounter(key []byte, ttlInSecond int64) error {
+	return d.expire(d.getCounterKey(key), ttlInSecond)
+}
+
+//PersistCounter remove ttl of counter with given key.
+//Return herbdata.ErrNotFound if counter not found.
+func (d *Driver) PersistCounter(key []byte) error {
+	return d.persist(d.getCounterKey(key))
+}
+
+func (d *Driver) pttl(k string) (time.Duration, error) {
+	conn := d.getReadConn(k)
+	defer conn.Close()
+	ttl, err := redis.Int64(conn.Do("PTTL", k))
+	if err != nil {
+		return 0, convertError(err)
+	}
+	switch ttl {
+	case -2:
+		return 0, herbdata.ErrNotFound
+	case -1:
+		return NoExpiry, nil
+	}
+	return time.Duration(ttl) * time.Millisecond, nil
+}
+
+func (d *Driver) expire(k string, ttlInSecond int64) error {
+	if ttlInSecond <= 0 {
+		return herbdata.ErrInvalidatedTTL
+	}
+	conn := d.getConn(k)
+	defer conn.Close()
+	ok, err := redis.Bool(conn.Do("EXPIRE", k, ttlInSecond))
+	if err != nil {
+		return convertError(err)
+	}
+	if !ok {
+		return herbdata.ErrNotFound
+	}
+	return nil
+}
+
+func (d *Driver) persist(k string) error {
+	conn := d.getConn(k)
+	defer conn.Close()
+	ok, err := redis.Bool(conn.Do("PERSIST", k))
+	if err != nil {
+		return convertError(err)
+	}
+	if ok {
+		return nil
+	}
+	//PERSIST replies 0 both for missing key and key without ttl.
+	ok, err = redis.Bool(conn.Do("EXISTS", k))
+	if err != nil {
+		return convertError(err)
+	}
+	if !ok {
+		return herbdata.ErrNotFound
+	}
+	return nil
+}
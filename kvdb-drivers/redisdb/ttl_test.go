@@ -0,0 +1,111 @@
+package redisdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/herb-go/herbdata"
+	"github.com/herb-go/herbdata/kvdb"
+)
+
+func testTTL(t *testing.T, d *Driver) {
+	var driver kvdb.Driver = d
+	if _, ok := driver.(TTLDriver); !ok {
+		t.Fatal(ok)
+	}
+	_, err := d.TTL([]byte("key"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	if d.Expire([]byte("key"), 100) != herbdata.ErrNotFound || d.Persist([]byte("key")) != herbdata.ErrNotFound {
+		t.Fatal()
+	}
+	err = d.Set([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttl, err := d.TTL([]byte("key"))
+	if err != nil || ttl != NoExpiry {
+		t.Fatal(ttl, err)
+	}
+	err = d.Persist([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Expire([]byte("key"), 0) != herbdata.ErrInvalidatedTTL {
+		t.Fatal()
+	}
+	err = d.Expire([]byte("key"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttl, err = d.TTL([]byte("key"))
+	if err != nil || ttl <= 90*time.Second || ttl > 100*time.Second {
+		t.Fatal(ttl, err)
+	}
+	//counter with same key should not be affected
+	_, err = d.CounterTTL([]byte("key"))
+	if err != herbdata.ErrNotFound {
+		t.Fatal(err)
+	}
+	err = d.Persist([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttl, err = d.TTL([]byte("key"))
+	if err != nil || ttl != NoExpiry {
+		t.Fatal(ttl, err)
+	}
+	if d.ExpireCounter([]byte("counter"), 100) != herbdata.ErrNotFound || d.PersistCounter([]byte("counter")) != herbdata.ErrNotFound {
+		t.Fatal()
+	}
+	err = d.SetCounterWithTTL([]byte("counter"), 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttl, err = d.CounterTTL([]byte("counter"))
+	if err != nil || ttl <= 0 || ttl > 10*time.Second {
+		t.Fatal(ttl, err)
+	}
+	err = d.ExpireCounter([]byte("counter"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttl, err = d.CounterTTL([]byte("counter"))
+	if err != nil || ttl <= 90*time.Second || ttl > 100*time.Second {
+		t.Fatal(ttl, err)
+	}
+	err = d.PersistCounter([]byte("counter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttl, err = d.CounterTTL([]byte("counter"))
+	if err != nil || ttl != NoExpiry {
+		t.Fatal(ttl, err)
+	}
+	v, err := d.GetCounter([]byte("counter"))
+	if err != nil || v != 1 {
+		t.Fatal(v, err)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	d := newTestDriver("ttl")
+	defer d.Close()
+	conn := d.Pool.Get()
+	_, err := conn.Do("FLUSHDB")
+	conn.Close()
+	if err != nil {
+		panic(err)
+	}
+	testTTL(t, d)
+}
+
+func TestClusterTTL(t *testing.T) {
+	d, fake := newTestClusterDriver()
+	defer d.Close()
+	testTTL(t, d)
+	if fake.misrouted != 0 {
+		t.Fatal(fake.misrouted)
+	}
+}